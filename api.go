@@ -1,16 +1,32 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	log "github.com/Sirupsen/logrus"
 	"github.com/emicklei/go-restful"
 	"github.com/emicklei/go-restful/swagger"
+	"github.com/ghodss/yaml"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
 	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	MIME_YAML         = "application/yaml"
+	MIME_EVENT_STREAM = "text/event-stream"
 )
 
 type Api struct {
 	Process    *Process
+	Controller *Controller
+	Auth       *Auth
 	lock       sync.RWMutex
 	commitLock sync.Mutex
 }
@@ -20,6 +36,9 @@ func NewApi(Process *Process) (*Api, error) {
 	api.Process = Process
 
 	api.lock = sync.RWMutex{}
+
+	// Deployments copy config while it is not written through api
+	api.Process.ConfigLock = api.lock.RLocker()
 	return &api, nil
 }
 
@@ -45,6 +64,7 @@ func (a *Api) getResource(resources interface{}) restful.RouteFunction {
 
 		name := req.PathParameter("name")
 		if resource, ok := resourceIndex[name]; ok {
+			res.AddHeader("ETag", versionETag(reflect.ValueOf(resource).FieldByName("Version").Uint()))
 			res.WriteEntity(resource)
 		} else {
 			res.WriteErrorString(http.StatusNotFound, "Resource not found.")
@@ -55,6 +75,7 @@ func (a *Api) getResource(resources interface{}) restful.RouteFunction {
 func (a *Api) deleteResource(resources interface{}) restful.RouteFunction {
 	return func(req *restful.Request, res *restful.Response) {
 		a.lock.Lock()
+		defer a.lock.Unlock()
 
 		reflected := reflect.ValueOf(resources).Elem()
 		out := reflect.MakeSlice(reflected.Type(), 0, reflected.Len())
@@ -64,22 +85,29 @@ func (a *Api) deleteResource(resources interface{}) restful.RouteFunction {
 		for i := 0; i < reflected.Len(); i++ {
 			if reflected.Index(i).FieldByName("Name").String() != name {
 				out = reflect.Append(out, reflected.Index(i))
-			} else {
-				found = true
+				continue
+			}
+
+			if !checkVersion(req, res, reflected.Index(i), reflect.Value{}) {
+				return
 			}
+			found = true
 		}
-		reflected.Set(out)
-		a.lock.Unlock()
 
 		if !found {
 			res.WriteErrorString(http.StatusNotFound, "Resource not found")
+			return
 		}
+
+		reflected.Set(out)
 	}
 }
 
 func (a *Api) createResource(resources interface{}) restful.RouteFunction {
 	return func(req *restful.Request, res *restful.Response) {
 		a.lock.Lock()
+		defer a.lock.Unlock()
+
 		reflected := reflect.ValueOf(resources).Elem()
 
 		resourceIndex := IndexList(
@@ -93,7 +121,11 @@ func (a *Api) createResource(resources interface{}) restful.RouteFunction {
 		newValue := reflect.New(reflected.Type().Elem())
 		err := req.ReadEntity(newValue.Interface())
 		if err != nil {
-			res.WriteError(http.StatusBadGateway, err)
+			res.WriteError(http.StatusBadRequest, err)
+			return
+		}
+
+		if !validateResource(res, newValue, a.Process.Config) {
 			return
 		}
 
@@ -102,15 +134,19 @@ func (a *Api) createResource(resources interface{}) restful.RouteFunction {
 			return
 		}
 
+		version := a.Process.Config.NextVersion()
+		newValue.Elem().FieldByName("Version").SetUint(version)
+
 		reflected.Set(reflect.Append(reflected, newValue.Elem()))
+		res.AddHeader("ETag", versionETag(version))
 		res.WriteEntity(newValue.Interface())
-		a.lock.Unlock()
 	}
 }
 
 func (a *Api) updateResource(resources interface{}) restful.RouteFunction {
 	return func(req *restful.Request, res *restful.Response) {
 		a.lock.Lock()
+		defer a.lock.Unlock()
 
 		reflected := reflect.ValueOf(resources).Elem()
 
@@ -122,25 +158,470 @@ func (a *Api) updateResource(resources interface{}) restful.RouteFunction {
 				err := req.ReadEntity(newValue.Interface())
 				if err != nil {
 					res.WriteError(http.StatusBadRequest, err)
-					a.lock.Unlock()
 					return
 				}
 
+				if !validateResource(res, newValue, a.Process.Config) {
+					return
+				}
+
+				if !checkVersion(req, res, reflected.Index(i), newValue.Elem()) {
+					return
+				}
+
+				version := a.Process.Config.NextVersion()
+				newValue.Elem().FieldByName("Version").SetUint(version)
+
 				reflected.Index(i).Set(newValue.Elem())
+				res.AddHeader("ETag", versionETag(version))
 				res.WriteEntity(newValue.Interface())
-				a.lock.Unlock()
 				return
 			}
 		}
-		a.lock.Unlock()
 
 		res.WriteErrorString(http.StatusNotFound, "Resource not found.")
 	}
 }
 
-// Applies new configuration
+// Resource that is validated before it is written
+type validator interface {
+	Validate(config *Config) error
+}
+
+// Validates resource against config if it supports validation
+func validateResource(res *restful.Response, value reflect.Value, config *Config) bool {
+	v, ok := value.Interface().(validator)
+	if !ok {
+		return true
+	}
+
+	if err := v.Validate(config); err != nil {
+		res.WriteError(http.StatusBadRequest, err)
+		return false
+	}
+
+	return true
+}
+
+// Renders template with supplied or sample tags and validates generated
+// objects
+func (a *Api) validateTemplate(req *restful.Request, res *restful.Response) {
+	tags := Tags{}
+	if req.Request.ContentLength != 0 {
+		if err := req.ReadEntity(&tags); err != nil && err != io.EOF {
+			res.WriteError(http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	a.lock.RLock()
+	templates := IndexList(func(t interface{}) string { return t.(Template).Name }, a.Process.Config.Templates)
+	partials := append([]Template{}, a.Process.Config.Templates...)
+	a.lock.RUnlock()
+
+	tpl, ok := templates[req.PathParameter("name")]
+	if !ok {
+		res.WriteErrorString(http.StatusNotFound, "Resource not found.")
+		return
+	}
+
+	template := tpl.(Template)
+	res.WriteEntity(template.Check(a.Process.Kube, tags, partials))
+}
+
+// Updates tags of a namespace
+func (a *Api) updateNamespaceTags(req *restful.Request, res *restful.Response) {
+	tags := Tags{}
+	if err := req.ReadEntity(&tags); err != nil {
+		res.WriteError(http.StatusBadRequest, err)
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	name := req.PathParameter("name")
+	for idx, ns := range a.Process.Config.Namespaces {
+		if ns.Name == name {
+			if !checkVersion(req, res, reflect.ValueOf(ns), reflect.Value{}) {
+				return
+			}
+
+			a.Process.Config.Namespaces[idx].Tags = tags
+			a.Process.Config.Namespaces[idx].Version = a.Process.Config.NextVersion()
+			res.AddHeader("ETag", versionETag(a.Process.Config.Namespaces[idx].Version))
+			res.WriteEntity(a.Process.Config.Namespaces[idx])
+			return
+		}
+	}
+
+	res.WriteErrorString(http.StatusNotFound, "Resource not found.")
+}
+
+// Renders objects of app as they would be deployed to namespace, as JSON
+// or YAML list depending on Accept header
+func (a *Api) renderApp(req *restful.Request, res *restful.Response) {
+	a.lock.RLock()
+	objs, err := a.Process.Render(req.PathParameter("name"), req.PathParameter("app"))
+	a.lock.RUnlock()
+
+	if err == ErrNamespaceNotFound || err == ErrAppNotFound {
+		res.WriteError(http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		res.WriteError(http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	data, err := a.Process.Kube.Codec.Encode(&api.List{Items: objs})
+	if err != nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	contentType := restful.MIME_JSON
+	if strings.Contains(req.HeaderParameter("Accept"), "yaml") {
+		if data, err = yaml.JSONToYAML(data); err != nil {
+			res.WriteError(http.StatusInternalServerError, err)
+			return
+		}
+		contentType = MIME_YAML
+	}
+
+	res.Header().Set("Content-Type", contentType)
+	res.Write(data)
+}
+
+// Returns tags app is rendered with in namespace
+func (a *Api) appTags(req *restful.Request, res *restful.Response) {
+	a.lock.RLock()
+	tags, err := a.Process.AppTags(req.PathParameter("name"), req.PathParameter("app"))
+	a.lock.RUnlock()
+
+	if err != nil {
+		res.WriteError(http.StatusNotFound, err)
+		return
+	}
+
+	res.WriteEntity(tags)
+}
+
+// Promotes canary or blue-green rollout of app waiting in namespace
+func (a *Api) promoteRollout(req *restful.Request, res *restful.Response) {
+	a.decideRollout(req, res, true)
+}
+
+// Aborts canary or blue-green rollout of app waiting in namespace, canary is
+// removed and services are switched back to old pods
+func (a *Api) abortRollout(req *restful.Request, res *restful.Response) {
+	a.decideRollout(req, res, false)
+}
+
+func (a *Api) decideRollout(req *restful.Request, res *restful.Response, promote bool) {
+	a.lock.RLock()
+	err := a.Process.DecideRollout(req.PathParameter("name"), req.PathParameter("app"), promote)
+	a.lock.RUnlock()
+
+	if err != nil {
+		res.WriteError(http.StatusNotFound, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+// Formats resource version as ETag
+func versionETag(version uint64) string {
+	return strconv.Quote(strconv.FormatUint(version, 10))
+}
+
+// Checks that request modifies current version of resource, expected version
+// is taken from If-Match header or from version field of request body
+func checkVersion(req *restful.Request, res *restful.Response, current, body reflect.Value) bool {
+	var expected uint64
+	if match := req.HeaderParameter("If-Match"); match != "" {
+		version, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(match, "W/"), `"`), 10, 64)
+		if err != nil {
+			res.WriteErrorString(http.StatusBadRequest, "If-Match header invalid.")
+			return false
+		}
+		expected = version
+	} else if body.IsValid() {
+		expected = body.FieldByName("Version").Uint()
+	}
+
+	if expected == 0 {
+		res.WriteErrorString(http.StatusPreconditionRequired, "Resource version required.")
+		return false
+	}
+
+	if expected != current.FieldByName("Version").Uint() {
+		res.WriteErrorString(http.StatusConflict, "Resource was changed by someone else.")
+		return false
+	}
+
+	return true
+}
+
+// Queues deployment of config, responds with queued deployment
 func (a *Api) commit(req *restful.Request, res *restful.Response) {
-	if err := a.Process.Commit(); err != nil {
+	a.lock.RLock()
+	deploy, err := a.Process.Commit(requestAuthor(req), SourceApi)
+	a.lock.RUnlock()
+
+	if err != nil {
+		writeCommitError(res, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+	res.WriteEntity(deploy)
+}
+
+func (a *Api) queue(req *restful.Request, res *restful.Response) {
+	res.WriteEntity(a.Process.Queue())
+}
+
+func (a *Api) revisions(req *restful.Request, res *restful.Response) {
+	revisions, err := a.Process.Revisions.List()
+	if err != nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	res.WriteEntity(revisions)
+}
+
+func (a *Api) revision(req *restful.Request, res *restful.Response) {
+	id, err := strconv.Atoi(req.PathParameter("id"))
+	if err != nil {
+		res.WriteErrorString(http.StatusBadRequest, "Revision id invalid.")
+		return
+	}
+
+	rev, err := a.Process.Revisions.Get(id)
+	if err == ErrRevisionNotFound {
+		res.WriteErrorString(http.StatusNotFound, "Revision not found.")
+		return
+	} else if err != nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	res.WriteEntity(rev)
+}
+
+// Restores configuration from revision and applies it
+func (a *Api) rollback(req *restful.Request, res *restful.Response) {
+	id, err := strconv.Atoi(req.PathParameter("id"))
+	if err != nil {
+		res.WriteErrorString(http.StatusBadRequest, "Revision id invalid.")
+		return
+	}
+
+	a.lock.Lock()
+	deploy, err := a.Process.Rollback(id, requestAuthor(req))
+	a.lock.Unlock()
+
+	if err == ErrRevisionNotFound {
+		res.WriteErrorString(http.StatusNotFound, "Revision not found.")
+		return
+	} else if err != nil {
+		writeCommitError(res, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+	res.WriteEntity(deploy)
+}
+
+func (a *Api) deploys(req *restful.Request, res *restful.Response) {
+	if a.Process.Deploys == nil {
+		res.WriteErrorString(http.StatusNotFound, "Deploy logs are disabled.")
+		return
+	}
+
+	deploys, err := a.Process.Deploys.List()
+	if err != nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	res.WriteEntity(deploys)
+}
+
+func (a *Api) getDeploy(req *restful.Request, res *restful.Response) {
+	id, ok := a.deployId(req, res)
+	if !ok {
+		return
+	}
+
+	deploy, err := a.Process.Deploys.Get(id)
+	if err == ErrDeployNotFound {
+		res.WriteErrorString(http.StatusNotFound, "Deploy not found.")
+		return
+	} else if err != nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	res.WriteEntity(deploy)
+}
+
+// Returns log entries of deployment matching filters of query parameters
+func (a *Api) deployLogs(req *restful.Request, res *restful.Response) {
+	id, ok := a.deployId(req, res)
+	if !ok {
+		return
+	}
+
+	query := LogQuery{
+		Namespace: req.QueryParameter("namespace"),
+		App:       req.QueryParameter("app"),
+		Level:     req.QueryParameter("level"),
+		Limit:     100,
+	}
+
+	if query.Level != "" {
+		if _, err := log.ParseLevel(query.Level); err != nil {
+			res.WriteErrorString(http.StatusBadRequest, "Level invalid.")
+			return
+		}
+	}
+
+	if since := req.QueryParameter("since"); since != "" {
+		var err error
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			res.WriteErrorString(http.StatusBadRequest, "Since must be RFC 3339 time.")
+			return
+		}
+	}
+
+	for name, value := range map[string]*int{"offset": &query.Offset, "limit": &query.Limit} {
+		if param := req.QueryParameter(name); param != "" {
+			number, err := strconv.Atoi(param)
+			if err != nil || number < 0 {
+				res.WriteErrorString(http.StatusBadRequest, "Offset and limit must be non-negative numbers.")
+				return
+			}
+			*value = number
+		}
+	}
+
+	page, err := QueryLogs(a.Process.Deploys, id, query)
+	if err == ErrDeployNotFound {
+		res.WriteErrorString(http.StatusNotFound, "Deploy not found.")
+		return
+	} else if err != nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	res.WriteEntity(page)
+}
+
+// Streams log entries and state transitions of deployment as server-sent
+// events, stream ends when deployment finishes
+func (a *Api) deployEvents(req *restful.Request, res *restful.Response) {
+	id, err := strconv.Atoi(req.PathParameter("id"))
+	if err != nil {
+		res.WriteErrorString(http.StatusBadRequest, "Deploy id invalid.")
+		return
+	}
+
+	past, events, err := a.Process.DeployEvents(id)
+	if err == ErrDeployNotFound {
+		res.WriteErrorString(http.StatusNotFound, "Deploy not found.")
+		return
+	} else if err != nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	if events != nil {
+		defer a.Process.StopDeployEvents(events)
+	}
+
+	// Reconnecting clients continue after last event they received
+	skip := 0
+	if last, err := strconv.Atoi(req.Request.Header.Get("Last-Event-ID")); err == nil {
+		skip = last + 1
+	}
+
+	res.Header().Set("Content-Type", MIME_EVENT_STREAM)
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+
+	seq := 0
+	write := func(event DeployEvent) error {
+		defer func() { seq++ }()
+		if seq < skip {
+			return nil
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(res, "id: %v\nevent: %v\ndata: %s\n\n", seq, event.Type, data); err != nil {
+			return err
+		}
+		if flusher, ok := res.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+
+		return nil
+	}
+
+	for _, event := range past {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+
+	var closed <-chan bool
+	if notifier, ok := res.ResponseWriter.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+
+	for events != nil {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// Parses deploy id path parameter, writes error if it is invalid or deploy
+// logs are disabled
+func (a *Api) deployId(req *restful.Request, res *restful.Response) (int, bool) {
+	if a.Process.Deploys == nil {
+		res.WriteErrorString(http.StatusNotFound, "Deploy logs are disabled.")
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(req.PathParameter("id"))
+	if err != nil {
+		res.WriteErrorString(http.StatusBadRequest, "Deploy id invalid.")
+		return 0, false
+	}
+
+	return id, true
+}
+
+// Writes error of queueing config deployment, errors writing config are
+// reported by deployment
+func writeCommitError(res *restful.Response, err error) {
+	if _, ok := err.(*DependencyError); ok {
+		res.WriteError(http.StatusBadRequest, err)
+	} else {
 		res.WriteError(http.StatusInternalServerError, err)
 	}
 }
@@ -158,7 +639,35 @@ func (a *Api) status(req *restful.Request, res *restful.Response) {
 			}
 		}
 	}
-	res.WriteEntity(map[string]interface{}{"state": state, "err": err, "errors": errors, "logs": logs})
+	status := map[string]interface{}{
+		"state": state, "err": err, "errors": errors, "logs": logs,
+		"failed": AppErrors(err), "namespaces": a.Process.NamespaceStatus(),
+		"rollouts": a.Process.PendingRollouts(), "deploy": a.Process.DeployId(),
+		"queue": a.Process.Queue(),
+	}
+	if a.Controller != nil {
+		status["drift"] = a.Controller.Drift()
+	}
+	res.WriteEntity(status)
+}
+
+// Shows actions that deployment of current config would perform
+func (a *Api) plan(req *restful.Request, res *restful.Response) {
+	plan, logger, err := a.Process.Plan()
+	if plan == nil {
+		res.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+
+	errors := []map[string]interface{}{}
+	if logger != nil {
+		for _, entry := range logger.Entries {
+			if entry.Level == log.ErrorLevel {
+				errors = append(errors, map[string]interface{}{"msg": entry.Message, "fields": entry.Data})
+			}
+		}
+	}
+	res.WriteEntity(map[string]interface{}{"actions": plan.Actions, "err": err, "errors": errors})
 }
 
 func (a *Api) newtag(req *restful.Request, res *restful.Response) {
@@ -169,39 +678,50 @@ func (a *Api) newtag(req *restful.Request, res *restful.Response) {
 	log.Debugf("Newtag %v %v", name, tag)
 
 	if tag == "" || tag == name {
+		newtagHooksTotal.WithLabelValues("invalid").Inc()
 		res.WriteErrorString(http.StatusBadRequest, "Tag name invalid.")
 		return
 	}
 
+	a.lock.Lock()
 	for idx, app := range a.Process.Config.Applications {
-		image, ok := app.Tags["image"]
-		if !ok || image != name {
+		if app.Tags.String("image") != name {
 			continue
 		}
 
-		_, ok = app.Tags["tag"]
-		if !ok {
+		if _, ok := app.Tags["tag"]; !ok {
 			continue
 		}
 
-		autoupdate, ok := app.Tags["autoupdate"]
-		if !ok || autoupdate != "true" {
+		if app.Tags.String("autoupdate") != "true" {
 			continue
 		}
 
 		a.Process.Config.Applications[idx].Tags["tag"] = tag
-
-		if err := a.Process.Commit(); err != nil {
-			res.WriteError(http.StatusInternalServerError, err)
-			continue
-		}
-
+		a.Process.Config.Applications[idx].Version = a.Process.Config.NextVersion()
 		imageFound = true
 	}
+	a.lock.Unlock()
 
 	if !imageFound {
+		newtagHooksTotal.WithLabelValues("not_found").Inc()
 		res.WriteErrorString(http.StatusNotFound, "Image not found.")
+		return
 	}
+
+	a.lock.RLock()
+	deploy, err := a.Process.Commit(requestAuthor(req), SourceNewtag)
+	a.lock.RUnlock()
+
+	if err != nil {
+		newtagHooksTotal.WithLabelValues("failed").Inc()
+		writeCommitError(res, err)
+		return
+	}
+	newtagHooksTotal.WithLabelValues("queued").Inc()
+
+	res.WriteHeader(http.StatusAccepted)
+	res.WriteEntity(deploy)
 }
 
 // Registers api and starts serving on specified host
@@ -223,6 +743,7 @@ func (api *Api) Serve(host string) error {
 		Returns(200, "OK", []Application{}))
 
 	ws.Route(ws.POST("/").To(api.createResource(&api.Process.Config.Applications)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("creates an apps").
 		Operation("createApp").
@@ -236,18 +757,24 @@ func (api *Api) Serve(host string) error {
 		Writes(Application{}))
 
 	ws.Route(ws.PUT("/{name}").To(api.updateResource(&api.Process.Config.Applications)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("update an app").
 		Operation("updateApp").
 		Param(ws.PathParameter("name", "name of on app").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")).
 		Reads(Application{}))
 
 	ws.Route(ws.DELETE("/{name}").To(api.deleteResource(&api.Process.Config.Applications)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("delete an app").
 		Operation("removeApp").
-		Param(ws.PathParameter("name", "name of on app").DataType("string")))
+		Param(ws.PathParameter("name", "name of on app").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")))
 
+	ws.Filter(api.measure)
+	ws.Filter(api.authenticate)
 	restful.Add(ws)
 
 	// Groups
@@ -265,6 +792,7 @@ func (api *Api) Serve(host string) error {
 		Returns(200, "OK", []ApplicationGroup{}))
 
 	ws.Route(ws.POST("/").To(api.createResource(&api.Process.Config.ApplicationGroups)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("creates application group").
 		Operation("createApplicationGroup").
@@ -278,18 +806,24 @@ func (api *Api) Serve(host string) error {
 		Writes(ApplicationGroup{}))
 
 	ws.Route(ws.PUT("/{name}").To(api.updateResource(&api.Process.Config.ApplicationGroups)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("update appliction group").
 		Operation("updateApp").
 		Param(ws.PathParameter("name", "name of application group").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")).
 		Reads(ApplicationGroup{}))
 
 	ws.Route(ws.DELETE("/{name}").To(api.deleteResource(&api.Process.Config.ApplicationGroups)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("removes application group").
 		Operation("removeApplicationGroup").
-		Param(ws.PathParameter("name", "name of application group").DataType("string")))
+		Param(ws.PathParameter("name", "name of application group").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")))
 
+	ws.Filter(api.measure)
+	ws.Filter(api.authenticate)
 	restful.Add(ws)
 
 	// Namespaces
@@ -307,6 +841,7 @@ func (api *Api) Serve(host string) error {
 		Returns(200, "OK", []Namespace{}))
 
 	ws.Route(ws.POST("/").To(api.createResource(&api.Process.Config.Namespaces)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("creates namespace").
 		Operation("createNamespace").
@@ -320,18 +855,66 @@ func (api *Api) Serve(host string) error {
 		Writes(Namespace{}))
 
 	ws.Route(ws.PUT("/{name}").To(api.updateResource(&api.Process.Config.Namespaces)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("updates namespace").
 		Operation("updateNamespace").
 		Param(ws.PathParameter("name", "name of the namespace").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")).
 		Reads(Namespace{}))
 
+	ws.Route(ws.PUT("/{name}/tags").To(api.updateNamespaceTags).
+		Filter(api.requireNamespace).
+		//docs
+		Doc("updates namespace tags").
+		Operation("updateNamespaceTags").
+		Param(ws.PathParameter("name", "name of the namespace").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")).
+		Reads(Tags{}))
+
+	ws.Route(ws.GET("/{name}/apps/{app}/tags").To(api.appTags).
+		//docs
+		Doc("gets tags app is rendered with in namespace, merged from namespace, group, app and overrides").
+		Operation("findAppTags").
+		Param(ws.PathParameter("name", "name of the namespace").DataType("string")).
+		Param(ws.PathParameter("app", "name of the app").DataType("string")).
+		Writes(Tags{}))
+
+	ws.Route(ws.GET("/{name}/apps/{app}/rendered").To(api.renderApp).
+		Filter(api.requireNamespace).
+		Produces(restful.MIME_JSON, MIME_YAML).
+		//docs
+		Doc("renders objects of app as they would be deployed to namespace").
+		Operation("renderApp").
+		Param(ws.PathParameter("name", "name of the namespace").DataType("string")).
+		Param(ws.PathParameter("app", "name of the app").DataType("string")))
+
+	ws.Route(ws.POST("/{name}/apps/{app}/promote").To(api.promoteRollout).
+		Filter(api.requireNamespace).
+		//docs
+		Doc("promotes canary or blue-green rollout of app waiting in namespace").
+		Operation("promoteRollout").
+		Param(ws.PathParameter("name", "name of the namespace").DataType("string")).
+		Param(ws.PathParameter("app", "name of the app").DataType("string")))
+
+	ws.Route(ws.POST("/{name}/apps/{app}/abort").To(api.abortRollout).
+		Filter(api.requireNamespace).
+		//docs
+		Doc("aborts canary or blue-green rollout of app waiting in namespace, switching back to old pods").
+		Operation("abortRollout").
+		Param(ws.PathParameter("name", "name of the namespace").DataType("string")).
+		Param(ws.PathParameter("app", "name of the app").DataType("string")))
+
 	ws.Route(ws.DELETE("/{name}").To(api.deleteResource(&api.Process.Config.Namespaces)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("removes namespace").
 		Operation("removeNamespace").
-		Param(ws.PathParameter("name", "name of the namespace").DataType("string")))
+		Param(ws.PathParameter("name", "name of the namespace").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")))
 
+	ws.Filter(api.measure)
+	ws.Filter(api.authenticate)
 	restful.Add(ws)
 
 	// Templates
@@ -349,6 +932,7 @@ func (api *Api) Serve(host string) error {
 		Returns(200, "OK", []Template{}))
 
 	ws.Route(ws.POST("/").To(api.createResource(&api.Process.Config.Templates)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("creates template").
 		Operation("createTemplate").
@@ -362,18 +946,32 @@ func (api *Api) Serve(host string) error {
 		Writes(Template{}))
 
 	ws.Route(ws.PUT("/{name}").To(api.updateResource(&api.Process.Config.Templates)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("updates template").
 		Operation("updateTemplate").
 		Param(ws.PathParameter("name", "name of the template").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")).
 		Reads(Template{}))
 
+	ws.Route(ws.POST("/{name}/validate").To(api.validateTemplate).
+		//docs
+		Doc("renders template with supplied or sample tags and validates generated objects").
+		Operation("validateTemplate").
+		Param(ws.PathParameter("name", "name of the template").DataType("string")).
+		Reads(Tags{}).
+		Writes(TemplateValidation{}))
+
 	ws.Route(ws.DELETE("/{name}").To(api.deleteResource(&api.Process.Config.Templates)).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("removes template").
 		Operation("removeTemplate").
-		Param(ws.PathParameter("name", "name of the template").DataType("string")))
+		Param(ws.PathParameter("name", "name of the template").DataType("string")).
+		Param(ws.HeaderParameter("If-Match", "version of resource, alternatively set in body").DataType("string")))
 
+	ws.Filter(api.measure)
+	ws.Filter(api.authenticate)
 	restful.Add(ws)
 
 	// Deployment
@@ -385,13 +983,87 @@ func (api *Api) Serve(host string) error {
 		Doc("Deployment of configuration")
 
 	ws.Route(ws.POST("/").To(api.commit).
+		Filter(api.requireAdmin).
 		//docs
-		Doc("deploys config").Operation("deploy"))
+		Doc("queues deployment of config, requests queued while another deployment runs are coalesced").Operation("deploy").
+		Param(ws.QueryParameter("author", "who deploys config").DataType("string")).
+		Returns(202, "Accepted", Deploy{}))
+
+	ws.Route(ws.GET("/queue").To(api.queue).
+		//docs
+		Doc("gets running and queued deployments").
+		Operation("findQueue").
+		Writes(DeployQueue{}))
 
 	ws.Route(ws.GET("/").To(api.status).
 		//docs
 		Doc("gets deployment status").Operation("deploy"))
 
+	ws.Route(ws.POST("/plan").To(api.plan).
+		Filter(api.requireAdmin).
+		//docs
+		Doc("shows actions deployment of config would perform, without applying them").
+		Operation("plan").
+		Returns(200, "OK", []Action{}))
+
+	ws.Route(ws.GET("/revisions").To(api.revisions).
+		//docs
+		Doc("gets all deployed revisions").
+		Operation("findRevisions").
+		Returns(200, "OK", []Revision{}))
+
+	ws.Route(ws.GET("/revisions/{id}").To(api.revision).
+		//docs
+		Doc("gets a deployed revision").
+		Operation("findRevision").
+		Param(ws.PathParameter("id", "revision number").DataType("int")).
+		Writes(Revision{}))
+
+	ws.Route(ws.POST("/revisions/{id}/rollback").To(api.rollback).
+		Filter(api.requireAdmin).
+		//docs
+		Doc("restores config from revision and queues its deployment").
+		Operation("rollback").
+		Param(ws.PathParameter("id", "revision number").DataType("int")).
+		Param(ws.QueryParameter("author", "who deploys config").DataType("string")).
+		Returns(202, "Accepted", Deploy{}))
+
+	ws.Route(ws.GET("/history").To(api.deploys).
+		//docs
+		Doc("gets all recorded deployments").
+		Operation("findDeploys").
+		Returns(200, "OK", []Deploy{}))
+
+	ws.Route(ws.GET("/{id}").To(api.getDeploy).
+		//docs
+		Doc("gets a recorded deployment").
+		Operation("findDeploy").
+		Param(ws.PathParameter("id", "deploy number").DataType("int")).
+		Writes(Deploy{}))
+
+	ws.Route(ws.GET("/{id}/logs").To(api.deployLogs).
+		//docs
+		Doc("gets log entries of deployment").
+		Operation("findDeployLogs").
+		Param(ws.PathParameter("id", "deploy number").DataType("int")).
+		Param(ws.QueryParameter("namespace", "only entries of namespace").DataType("string")).
+		Param(ws.QueryParameter("app", "only entries of app").DataType("string")).
+		Param(ws.QueryParameter("level", "only entries of level or more severe, like warning").DataType("string")).
+		Param(ws.QueryParameter("since", "only entries logged after RFC 3339 time").DataType("string")).
+		Param(ws.QueryParameter("offset", "number of matching entries to skip").DataType("int")).
+		Param(ws.QueryParameter("limit", "maximum number of entries returned, 100 by default, 0 for all").DataType("int")).
+		Writes(LogPage{}))
+
+	ws.Route(ws.GET("/{id}/events").To(api.deployEvents).
+		Produces(MIME_EVENT_STREAM, restful.MIME_JSON).
+		//docs
+		Doc("streams log entries and state transitions of deployment as server-sent events").
+		Operation("streamDeployEvents").
+		Param(ws.PathParameter("id", "deploy number").DataType("int")).
+		Returns(200, "OK", DeployEvent{}))
+
+	ws.Filter(api.measure)
+	ws.Filter(api.authenticate)
 	restful.Add(ws)
 
 	// Deployment hooks
@@ -403,10 +1075,13 @@ func (api *Api) Serve(host string) error {
 		Doc("Deployment hooks")
 
 	ws.Route(ws.POST("/newtag").To(api.newtag).
+		Filter(api.requireAdmin).
 		//docs
 		Doc("updates all images that have autodeploy enabled").
 		Operation("newtag"))
 
+	ws.Filter(api.measure)
+	ws.Filter(api.authenticate)
 	restful.Add(ws)
 
 	config := swagger.Config{
@@ -416,6 +1091,8 @@ func (api *Api) Serve(host string) error {
 		SwaggerFilePath: "swagger"}
 	swagger.InstallSwaggerService(config)
 
+	http.Handle("/metrics", prometheus.Handler())
+
 	err := http.ListenAndServe(host, nil)
 	if err != nil {
 		log.Errorf("Cannot listen %v", err)
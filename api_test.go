@@ -0,0 +1,236 @@
+package main
+
+import (
+	kapi "github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/emicklei/go-restful"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestResourceVersion(t *testing.T) {
+	config := &Config{}
+	config.Load(strings.NewReader("templates:\n- name: web\n  template: a\n"))
+	if config.Templates[0].Version != 1 {
+		t.Fatalf("expected version assigned on load, got %v", config.Templates[0].Version)
+	}
+
+	api := &Api{Process: &Process{Config: config}}
+	ws := new(restful.WebService)
+	ws.Path("/templates").Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/{name}").To(api.getResource(&config.Templates)))
+	ws.Route(ws.PUT("/{name}").To(api.updateResource(&config.Templates)))
+	ws.Route(ws.DELETE("/{name}").To(api.deleteResource(&config.Templates)))
+	container := restful.NewContainer()
+	container.Add(ws)
+
+	do := func(method, body, match string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/templates/web", strings.NewReader(body))
+		req.Header.Set("Content-Type", restful.MIME_JSON)
+		if match != "" {
+			req.Header.Set("If-Match", match)
+		}
+
+		res := httptest.NewRecorder()
+		container.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := do("GET", "", ""); res.Header().Get("ETag") != `"1"` {
+		t.Errorf("expected ETag \"1\", got %v", res.Header().Get("ETag"))
+	}
+
+	if res := do("PUT", `{"name": "web", "template": "b"}`, ""); res.Code != 428 {
+		t.Errorf("expected update without version to be rejected, got %v", res.Code)
+	}
+
+	if res := do("PUT", `{"name": "web", "template": "b", "version": 1}`, ""); res.Code != http.StatusOK {
+		t.Errorf("expected update with body version to succeed, got %v", res.Code)
+	}
+
+	if config.Templates[0].Content != "b" || config.Templates[0].Version != 2 {
+		t.Errorf("expected template updated to version 2, got %+v", config.Templates[0])
+	}
+
+	if res := do("PUT", `{"name": "web", "template": "c"}`, `"1"`); res.Code != http.StatusConflict {
+		t.Errorf("expected update of stale version to conflict, got %v", res.Code)
+	}
+
+	if res := do("DELETE", "", `"1"`); res.Code != http.StatusConflict || len(config.Templates) != 1 {
+		t.Errorf("expected delete of stale version to conflict, got %v", res.Code)
+	}
+
+	if res := do("DELETE", "", `"2"`); res.Code != http.StatusOK || len(config.Templates) != 0 {
+		t.Errorf("expected delete to succeed, got %v", res.Code)
+	}
+}
+
+func TestRenderApp(t *testing.T) {
+	kube, _ := client.New(&client.Config{Version: "v1beta3"})
+	content, _ := ioutil.ReadFile("./test-service.yaml")
+
+	config := &Config{
+		Project:           "test",
+		Templates:         []Template{{Name: "service", Content: string(content)}},
+		Applications:      []Application{{Name: "web", Service: "service", Tags: Tags{"name": "app"}}},
+		ApplicationGroups: []ApplicationGroup{{Name: "all", Applications: []string{"web"}, Tags: Tags{"name": "group"}}},
+		Namespaces:        []Namespace{{Name: "prod", ApplicationGroup: "all"}},
+	}
+
+	api := &Api{Process: &Process{Kube: kube, Config: config}}
+	ws := new(restful.WebService)
+	ws.Path("/namespaces").Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/{name}/apps/{app}/rendered").To(api.renderApp).Produces(restful.MIME_JSON, MIME_YAML))
+	container := restful.NewContainer()
+	container.Add(ws)
+
+	do := func(path, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		res := httptest.NewRecorder()
+		container.ServeHTTP(res, req)
+		return res
+	}
+
+	res := do("/namespaces/prod/apps/web/rendered", restful.MIME_JSON)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected success, got %v %v", res.Code, res.Body)
+	}
+
+	obj, err := kube.Codec.Decode(res.Body.Bytes())
+	if err != nil {
+		t.Fatalf("expected list, got %v", err)
+	}
+
+	list := obj.(*kapi.List)
+	if len(list.Items) != 1 {
+		t.Fatalf("expected one object, got %v", list.Items)
+	}
+
+	service := list.Items[0].(*kapi.Service)
+	if service.Name != "web" || service.Spec.Selector["role"] != "app" || service.Labels["kubehub/name"] != "web" {
+		t.Errorf("expected service rendered with app tags and labels, got %+v", service.ObjectMeta)
+	}
+
+	res = do("/namespaces/prod/apps/web/rendered", MIME_YAML)
+	if res.Header().Get("Content-Type") != MIME_YAML || !strings.Contains(res.Body.String(), "role: app") {
+		t.Errorf("expected YAML list, got %v", res.Body)
+	}
+
+	if res := do("/namespaces/prod/apps/db/rendered", restful.MIME_JSON); res.Code != http.StatusNotFound {
+		t.Errorf("expected unknown app not found, got %v", res.Code)
+	}
+}
+
+func TestDeployLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileDeployStore(dir, 0)
+	deploy := &Deploy{}
+	store.Create(deploy)
+	store.Append(deploy.Id, LogEntry{Level: "info", Message: "Creating namespace"})
+	store.Append(deploy.Id, LogEntry{Level: "error", Message: "Cannot create service"})
+
+	api := &Api{Process: &Process{Deploys: store, Revisions: NewFileRevisionStore(dir + "/revisions")}}
+	ws := new(restful.WebService)
+	ws.Path("/deploy").Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/revisions").To(api.revisions))
+	ws.Route(ws.GET("/history").To(api.deploys))
+	ws.Route(ws.GET("/{id}").To(api.getDeploy))
+	ws.Route(ws.GET("/{id}/logs").To(api.deployLogs))
+	container := restful.NewContainer()
+	container.Add(ws)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		res := httptest.NewRecorder()
+		container.ServeHTTP(res, req)
+		return res
+	}
+
+	for path, code := range map[string]int{
+		"/deploy/revisions":                  200,
+		"/deploy/history":                    200,
+		"/deploy/1":                          200,
+		"/deploy/2":                          404,
+		"/deploy/x/logs":                     400,
+		"/deploy/1/logs?level=loud":          400,
+		"/deploy/1/logs?since=yesterday":     400,
+		"/deploy/1/logs?limit=-1":            400,
+		"/deploy/1/logs?level=error&limit=1": 200,
+	} {
+		if res := get(path); res.Code != code {
+			t.Errorf("expected %v for %v, got %v %v", code, path, res.Code, res.Body)
+		}
+	}
+
+	if res := get("/deploy/1/logs?level=error"); !strings.Contains(res.Body.String(), "Cannot create service") || strings.Contains(res.Body.String(), "Creating namespace") {
+		t.Errorf("expected only error entry, got %v", res.Body)
+	}
+}
+
+func TestDeployEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileDeployStore(dir, 0)
+	finished := &Deploy{State: StateReady}
+	store.Create(finished)
+	store.Append(finished.Id, LogEntry{Level: "info", Message: "Creating namespace"})
+
+	api := &Api{Process: &Process{Deploys: store, stream: NewDeployStream()}}
+	ws := new(restful.WebService)
+	ws.Path("/deploy").Produces(restful.MIME_JSON)
+	ws.Route(ws.GET("/{id}/events").To(api.deployEvents).Produces(MIME_EVENT_STREAM, restful.MIME_JSON))
+	container := restful.NewContainer()
+	container.Add(ws)
+
+	get := func(path, lastId string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", MIME_EVENT_STREAM)
+		if lastId != "" {
+			req.Header.Set("Last-Event-ID", lastId)
+		}
+
+		res := httptest.NewRecorder()
+		container.ServeHTTP(res, req)
+		return res
+	}
+
+	res := get("/deploy/1/events", "")
+	if res.Code != 200 || res.Header().Get("Content-Type") != MIME_EVENT_STREAM {
+		t.Fatalf("expected event stream, got %v %v", res.Code, res.Header())
+	}
+	if body := res.Body.String(); !strings.HasPrefix(body, "id: 0\nevent: log\ndata: {") || !strings.Contains(body, "id: 1\nevent: state\n") {
+		t.Errorf("expected stored log entry and state, got %v", body)
+	}
+
+	if res := get("/deploy/5/events", ""); res.Code != http.StatusNotFound {
+		t.Errorf("expected unknown deploy not found, got %v", res.Code)
+	}
+
+	current := Deploy{Id: 2, State: StateProcessing}
+	api.Process.stream.Start(current)
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- get("/deploy/2/events", "0") }()
+
+	api.Process.stream.Publish(2, DeployEvent{Type: EventLog, Entry: &LogEntry{Message: "Creating service"}})
+	current.State = StateReady
+	api.Process.stream.Finish(current)
+
+	body := (<-done).Body.String()
+	if strings.Contains(body, "id: 0\n") || !strings.Contains(body, "Creating service") || !strings.Contains(body, "id: 2\nevent: state\n") {
+		t.Errorf("expected live events after last event id, got %v", body)
+	}
+}
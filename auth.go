@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/emicklei/go-restful"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCredentials = errors.New("Invalid credentials")
+
+// Authenticated user
+type User struct {
+	// User name
+	Name string `json:"name" yaml:"name" description:"User name"`
+
+	// Whether user can manage everything
+	Admin bool `json:"admin" yaml:"admin" description:"Whether user can manage everything"`
+
+	// Namespaces where user can edit tags
+	Namespaces []string `json:"namespaces" yaml:"namespaces" description:"Namespaces where user can edit tags"`
+}
+
+// Whether user can edit namespace
+func (u *User) CanEditNamespace(name string) bool {
+	if u.Admin {
+		return true
+	}
+
+	for _, ns := range u.Namespaces {
+		if ns == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticates request, returns user name or empty string if request does
+// not contain credentials for this authenticator
+type Authenticator interface {
+	Authenticate(req *http.Request) (string, error)
+}
+
+// Authenticates bearer tokens from a file with "token,user" lines
+type TokenAuthenticator struct {
+	tokens map[string]string
+}
+
+func NewTokenAuthenticator(path string) (*TokenAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ",")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+
+		tokens[fields[0]] = fields[1]
+	}
+
+	return &TokenAuthenticator{tokens}, scanner.Err()
+}
+
+func (a *TokenAuthenticator) Authenticate(req *http.Request) (string, error) {
+	token := bearerToken(req)
+	if token == "" || strings.Count(token, ".") == 2 {
+		return "", nil
+	}
+
+	if user, ok := a.tokens[token]; ok {
+		return user, nil
+	}
+
+	return "", ErrInvalidCredentials
+}
+
+// Authenticates http basic auth against htpasswd file, only SHA passwords
+// are supported
+type HtpasswdAuthenticator struct {
+	passwords map[string]string
+}
+
+func NewHtpasswdAuthenticator(path string) (*HtpasswdAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	passwords := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		// Plain text passwords are rejected, as are bcrypt and MD5 hashes that
+		// cannot be verified
+		if !strings.HasPrefix(fields[1], "{SHA}") {
+			return nil, fmt.Errorf("Unsupported password of user %v in htpasswd file, only SHA passwords (htpasswd -s) are supported", fields[0])
+		}
+
+		passwords[fields[0]] = fields[1]
+	}
+
+	return &HtpasswdAuthenticator{passwords}, scanner.Err()
+}
+
+func (a *HtpasswdAuthenticator) Authenticate(req *http.Request) (string, error) {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return "", nil
+	}
+
+	hash, ok := a.passwords[user]
+	if !ok {
+		return "", ErrInvalidCredentials
+	}
+
+	sum := sha1.Sum([]byte(password))
+	password = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(password)) != 1 {
+		return "", ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// Authenticates JWT bearer tokens signed with HS256 shared secret or RS256
+// private key matching the public key
+type JWTAuthenticator struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+func NewJWTAuthenticator(path string) (*JWTAuthenticator, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return &JWTAuthenticator{secret: key}, nil
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("JWT key is not RSA public key")
+	}
+
+	return &JWTAuthenticator{publicKey: rsaPub}, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(req *http.Request) (string, error) {
+	token := bearerToken(req)
+	if strings.Count(token, ".") != 2 {
+		return "", nil
+	}
+
+	parts := strings.Split(token, ".")
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	claims := struct {
+		Sub string `json:"sub"`
+		Exp int64  `json:"exp"`
+		Nbf int64  `json:"nbf"`
+	}{}
+
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	signature, err := base64.URLEncoding.DecodeString(padBase64(parts[2]))
+	if err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && a.secret != nil:
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return "", ErrInvalidCredentials
+		}
+	case header.Alg == "RS256" && a.publicKey != nil:
+		sum := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(a.publicKey, crypto.SHA256, sum[:], signature) != nil {
+			return "", ErrInvalidCredentials
+		}
+	default:
+		return "", ErrInvalidCredentials
+	}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", ErrInvalidCredentials
+	}
+
+	now := time.Now().Unix()
+	if (claims.Exp != 0 && now >= claims.Exp) || (claims.Nbf != 0 && now < claims.Nbf) || claims.Sub == "" {
+		return "", ErrInvalidCredentials
+	}
+
+	return claims.Sub, nil
+}
+
+func decodeJWTPart(part string, out interface{}) error {
+	data, err := base64.URLEncoding.DecodeString(padBase64(part))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func padBase64(s string) string {
+	if pad := len(s) % 4; pad != 0 {
+		return s + strings.Repeat("=", 4-pad)
+	}
+
+	return s
+}
+
+func bearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+}
+
+// Authentication and authorization of api requests
+type Auth struct {
+	Authenticators []Authenticator
+
+	// Roles of users by user name
+	Users map[string]*User
+}
+
+// Loads user roles from a YAML policy file
+func (a *Auth) LoadPolicy(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	policy := struct {
+		Users []*User `yaml:"users"`
+	}{}
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return err
+	}
+
+	a.Users = make(map[string]*User)
+	for _, user := range policy.Users {
+		a.Users[user.Name] = user
+	}
+
+	return nil
+}
+
+// Whether authentication is enabled
+func (a *Auth) Enabled() bool {
+	return a != nil && len(a.Authenticators) > 0
+}
+
+// Authenticates request, returns authenticated user with roles from policy
+func (a *Auth) Authenticate(req *http.Request) (*User, error) {
+	for _, authenticator := range a.Authenticators {
+		name, err := authenticator.Authenticate(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "" {
+			continue
+		}
+
+		if user, ok := a.Users[name]; ok {
+			return user, nil
+		}
+
+		return &User{Name: name}, nil
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// Filter that authenticates request and stores user in request attributes,
+// all requests are made by admin if authentication is disabled
+func (api *Api) authenticate(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
+	if !api.Auth.Enabled() {
+		req.SetAttribute("user", &User{Admin: true})
+		chain.ProcessFilter(req, res)
+		return
+	}
+
+	user, err := api.Auth.Authenticate(req.Request)
+	if err != nil {
+		res.AddHeader("WWW-Authenticate", `Basic realm="kubehub"`)
+		res.WriteErrorString(http.StatusUnauthorized, "Unauthorized.")
+		return
+	}
+
+	req.SetAttribute("user", user)
+	chain.ProcessFilter(req, res)
+}
+
+// Filter that allows only admins
+func (api *Api) requireAdmin(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
+	if !requestUser(req).Admin {
+		res.WriteErrorString(http.StatusForbidden, "Forbidden.")
+		return
+	}
+
+	chain.ProcessFilter(req, res)
+}
+
+// Filter that allows only users that can edit namespace from path
+func (api *Api) requireNamespace(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
+	if !requestUser(req).CanEditNamespace(req.PathParameter("name")) {
+		res.WriteErrorString(http.StatusForbidden, "Forbidden.")
+		return
+	}
+
+	chain.ProcessFilter(req, res)
+}
+
+// Returns authenticated user of request
+func requestUser(req *restful.Request) *User {
+	if user, ok := req.Attribute("user").(*User); ok {
+		return user
+	}
+
+	return &User{}
+}
+
+// Returns author of request, authenticated user name or author query parameter
+func requestAuthor(req *restful.Request) string {
+	if user := requestUser(req); user.Name != "" {
+		return user.Name
+	}
+
+	return req.QueryParameter("author")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer f.Close()
+
+	f.WriteString(content)
+	return f.Name()
+}
+
+func signHS256(secret, claims string) string {
+	encode := func(s string) string {
+		return strings.TrimRight(base64.URLEncoding.EncodeToString([]byte(s)), "=")
+	}
+
+	signed := encode(`{"alg":"HS256","typ":"JWT"}`) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+
+	return signed + "." + strings.TrimRight(base64.URLEncoding.EncodeToString(mac.Sum(nil)), "=")
+}
+
+func TestAuthenticate(t *testing.T) {
+	tokens := writeTempFile(t, "secret-token,admin\n")
+	defer os.Remove(tokens)
+	htpasswd := writeTempFile(t, "dev:{SHA}qUqP5cyxm6YcTAhz05Hph5gvu9M=\n")
+	defer os.Remove(htpasswd)
+	jwtKey := writeTempFile(t, "jwt-secret")
+	defer os.Remove(jwtKey)
+	policy := writeTempFile(t, "users:\n- name: admin\n  admin: true\n- name: dev\n  namespaces: [ns1]\n")
+	defer os.Remove(policy)
+
+	auth, err := newAuth(&AuthOptions{Tokens: tokens, Htpasswd: htpasswd, JWTKey: jwtKey, Policy: policy})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/apps", nil)
+	if _, err := auth.Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("expected invalid credentials, got %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer secret-token")
+	if user, err := auth.Authenticate(req); err != nil || !user.Admin {
+		t.Errorf("expected admin, got %v %v", user, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	if _, err := auth.Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("expected invalid credentials, got %v", err)
+	}
+
+	req.Header.Del("Authorization")
+	req.SetBasicAuth("dev", "test")
+	user, err := auth.Authenticate(req)
+	if err != nil || user.Admin || !user.CanEditNamespace("ns1") || user.CanEditNamespace("ns2") {
+		t.Errorf("expected dev with access to ns1, got %v %v", user, err)
+	}
+
+	req.SetBasicAuth("dev", "wrong")
+	if _, err := auth.Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("expected invalid credentials, got %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+signHS256("jwt-secret", `{"sub":"jwt-user"}`))
+	if user, err := auth.Authenticate(req); err != nil || user.Name != "jwt-user" || user.Admin {
+		t.Errorf("expected jwt-user, got %v %v", user, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+signHS256("jwt-secret", `{"sub":"jwt-user","exp":1}`))
+	if _, err := auth.Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("expected expired token to be invalid, got %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+signHS256("other-secret", `{"sub":"jwt-user"}`))
+	if _, err := auth.Authenticate(req); err != ErrInvalidCredentials {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+}
+
+func TestHtpasswdUnsupported(t *testing.T) {
+	for _, line := range []string{
+		"dev:test",
+		"dev:$2y$05$vW8DAk0FqDhvhIcLP3qGbO2iM3Y0cJ6yvC4HnX8.K1rDxF6m2k9vS",
+		"dev:$apr1$ruca84Hq$mbjdMZBAG.KWn7vfN/SNK/",
+	} {
+		htpasswd := writeTempFile(t, line+"\n")
+		defer os.Remove(htpasswd)
+
+		if _, err := NewHtpasswdAuthenticator(htpasswd); err == nil {
+			t.Errorf("expected password %v to be rejected", line)
+		}
+	}
+}
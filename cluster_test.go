@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/v1beta1"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var fakeLists = map[string]func() runtime.Object{
+	"namespaces":             func() runtime.Object { return &api.NamespaceList{} },
+	"secrets":                func() runtime.Object { return &api.SecretList{} },
+	"resourceQuotas":         func() runtime.Object { return &api.ResourceQuotaList{} },
+	"limitRanges":            func() runtime.Object { return &api.LimitRangeList{} },
+	"persistentVolumeClaims": func() runtime.Object { return &api.PersistentVolumeClaimList{} },
+	"endpoints":              func() runtime.Object { return &api.EndpointsList{} },
+	"services":               func() runtime.Object { return &api.ServiceList{} },
+	"replicationControllers": func() runtime.Object { return &api.ReplicationControllerList{} },
+	"pods":                   func() runtime.Object { return &api.PodList{} },
+}
+
+// Kubernetes api server keeping objects in memory, replication controllers
+// get their desired replicas at once unless they are stuck
+type fakeCluster struct {
+	t       *testing.T
+	objects map[string]runtime.Object
+	stuck   map[string]bool
+	writes  []string
+	version int
+	mutex   sync.Mutex
+}
+
+func newFakeCluster(t *testing.T) (*fakeCluster, *client.Client, *httptest.Server) {
+	cluster := &fakeCluster{t: t, objects: map[string]runtime.Object{}, stuck: map[string]bool{}}
+	server := httptest.NewServer(cluster)
+
+	kube, err := client.New(&client.Config{Host: server.URL, Version: "v1beta1", QPS: 1000})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	return cluster, kube, server
+}
+
+func fakeKey(resource, ns, name string) string {
+	return resource + "/" + ns + "/" + name
+}
+
+// Stores object as if it was created through api
+func (c *fakeCluster) add(resource, ns string, obj runtime.Object) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.store(resource, ns, obj)
+}
+
+// Returns stored object or nil
+func (c *fakeCluster) get(resource, ns, name string) runtime.Object {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.objects[fakeKey(resource, ns, name)]
+}
+
+// Returns create, update and delete requests as method and key of object
+func (c *fakeCluster) writeLog() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return append([]string{}, c.writes...)
+}
+
+func (c *fakeCluster) store(resource, ns string, obj runtime.Object) {
+	meta, _ := api.ObjectMetaFor(obj)
+	if resource != "namespaces" {
+		meta.Namespace = ns
+	}
+	if meta.UID == "" {
+		meta.UID = types.UID(fakeKey(resource, ns, meta.Name))
+	}
+	c.version++
+	meta.ResourceVersion = fmt.Sprint(c.version)
+
+	if rc, ok := obj.(*api.ReplicationController); ok && !c.stuck[rc.Name] {
+		rc.Status.Replicas = rc.Spec.Replicas
+	}
+
+	c.objects[fakeKey(resource, ns, meta.Name)] = obj
+}
+
+func (c *fakeCluster) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/api/v1beta1/"), "/")
+	resource, name := parts[0], ""
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+	ns := req.URL.Query().Get("namespace")
+	key := fakeKey(resource, ns, name)
+
+	newList, ok := fakeLists[resource]
+	if !ok {
+		c.t.Errorf("unexpected request %v %v", req.Method, req.URL)
+		c.status(w, http.StatusInternalServerError, api.StatusReasonUnknown)
+		return
+	}
+
+	switch req.Method {
+	case "GET":
+		if name == "" {
+			c.list(w, resource, ns, req.URL.Query().Get("labels"), newList())
+		} else if obj, ok := c.objects[key]; ok {
+			c.write(w, http.StatusOK, obj)
+		} else {
+			c.status(w, http.StatusNotFound, api.StatusReasonNotFound)
+		}
+	case "POST", "PUT":
+		data, _ := ioutil.ReadAll(req.Body)
+		obj, err := v1beta1.Codec.Decode(data)
+		if err != nil {
+			c.t.Errorf("cannot decode %v %v", req.URL, err)
+			c.status(w, http.StatusBadRequest, api.StatusReasonInvalid)
+			return
+		}
+
+		meta, _ := api.ObjectMetaFor(obj)
+		key = fakeKey(resource, ns, meta.Name)
+		current, exists := c.objects[key]
+		if exists && req.Method == "POST" {
+			c.status(w, http.StatusConflict, api.StatusReasonAlreadyExists)
+			return
+		} else if !exists && req.Method == "PUT" {
+			c.status(w, http.StatusNotFound, api.StatusReasonNotFound)
+			return
+		} else if exists && meta.ResourceVersion != "" {
+			if currentMeta, _ := api.ObjectMetaFor(current); currentMeta.ResourceVersion != meta.ResourceVersion {
+				c.status(w, http.StatusConflict, api.StatusReasonConflict)
+				return
+			}
+		}
+
+		c.writes = append(c.writes, req.Method+" "+key)
+		c.store(resource, ns, obj)
+		c.write(w, http.StatusOK, obj)
+	case "DELETE":
+		if _, ok := c.objects[key]; !ok {
+			c.status(w, http.StatusNotFound, api.StatusReasonNotFound)
+			return
+		}
+
+		c.writes = append(c.writes, req.Method+" "+key)
+		delete(c.objects, key)
+		c.write(w, http.StatusOK, &api.Status{Status: api.StatusSuccess})
+	}
+}
+
+func (c *fakeCluster) list(w http.ResponseWriter, resource, ns, selector string, list runtime.Object) {
+	matcher, err := labels.Parse(selector)
+	if err != nil {
+		c.status(w, http.StatusBadRequest, api.StatusReasonInvalid)
+		return
+	}
+
+	keys := []string{}
+	for key := range c.objects {
+		if strings.HasPrefix(key, resource+"/"+ns+"/") || (ns == "" && strings.HasPrefix(key, resource+"/")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	items := []runtime.Object{}
+	for _, key := range keys {
+		meta, _ := api.ObjectMetaFor(c.objects[key])
+		if matcher.Matches(labels.Set(meta.Labels)) {
+			items = append(items, c.objects[key])
+		}
+	}
+
+	runtime.SetList(list, items)
+	c.write(w, http.StatusOK, list)
+}
+
+func (c *fakeCluster) status(w http.ResponseWriter, code int, reason api.StatusReason) {
+	c.write(w, code, &api.Status{Status: api.StatusFailure, Reason: reason, Code: code, Message: string(reason)})
+}
+
+func (c *fakeCluster) write(w http.ResponseWriter, code int, obj runtime.Object) {
+	data, err := v1beta1.Codec.Encode(obj)
+	if err != nil {
+		c.t.Errorf("cannot encode %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
+
+// Config of app web deployed to namespace test-prod as service web and
+// replication controller web-<tag>
+func webConfig(tag string, rollout *RolloutStrategy) *Config {
+	return &Config{
+		Project: "test",
+		Templates: []Template{
+			{Name: "service", Content: `
+kind: Service
+apiVersion: v1beta3
+metadata:
+  name: web
+spec:
+  ports:
+  - port: 80
+    targetPort: 8080
+  selector:
+    app: web
+`},
+			{Name: "controller", Content: `
+kind: ReplicationController
+apiVersion: v1beta3
+metadata:
+  name: web-{{.tag}}
+spec:
+  replicas: 2
+  selector:
+    app: web
+    version: "{{.tag}}"
+  template:
+    metadata:
+      labels:
+        app: web
+        version: "{{.tag}}"
+    spec:
+      containers:
+      - name: web
+        image: "web:{{.tag}}"
+`},
+		},
+		Applications: []Application{
+			{Name: "web", Service: "service", ReplicationController: "controller", Tags: Tags{"tag": tag}, Rollout: rollout},
+		},
+		ApplicationGroups: []ApplicationGroup{{Name: "group", Applications: []string{"web"}}},
+		Namespaces:        []Namespace{{Name: "prod", ApplicationGroup: "group"}},
+	}
+}
+
+// Adds namespace test-prod with live service and replication controller
+// of app web at version
+func (c *fakeCluster) addWeb(version string) {
+	managed := map[string]string{"kubehub/enable": "true", "kubehub/project": "test", "kubehub/name": "web"}
+
+	c.add("namespaces", "", &api.Namespace{ObjectMeta: api.ObjectMeta{
+		Name:   "test-prod",
+		Labels: map[string]string{"kubehub/enable": "true", "kubehub/project": "test"},
+	}})
+	c.add("services", "test-prod", &api.Service{
+		ObjectMeta: api.ObjectMeta{Name: "web", Labels: managed},
+		Spec: api.ServiceSpec{
+			Selector: map[string]string{"app": "web"},
+			Ports:    []api.ServicePort{{Port: 80, Protocol: api.ProtocolTCP}},
+			PortalIP: "10.0.0.1",
+		},
+	})
+	c.addController(version, 2)
+}
+
+// Adds live replication controller of app web at version to namespace
+// test-prod
+func (c *fakeCluster) addController(version string, replicas int) {
+	managed := map[string]string{"kubehub/enable": "true", "kubehub/project": "test", "kubehub/name": "web"}
+	selector := map[string]string{"app": "web", "version": version}
+
+	c.add("replicationControllers", "test-prod", &api.ReplicationController{
+		ObjectMeta: api.ObjectMeta{Name: "web-" + version, Labels: managed},
+		Spec: api.ReplicationControllerSpec{
+			Replicas: replicas,
+			Selector: selector,
+			Template: &api.PodTemplateSpec{
+				ObjectMeta: api.ObjectMeta{Labels: selector},
+				Spec:       api.PodSpec{Containers: []api.Container{{Name: "web", Image: "web:" + version}}},
+			},
+		},
+	})
+}
+
+// Returns process deploying config to fake cluster
+func newClusterProcess(t *testing.T, kube *client.Client, config *Config) *Process {
+	p, err := NewProcess(kube, config, &blockingStore{}, nil)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	return p
+}
+
+// Logger that discards entries
+func quietLogger() *log.Logger {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	return logger
+}
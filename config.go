@@ -7,7 +7,9 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
 	"gopkg.in/yaml.v2"
 	"io"
-	"text/template"
+	"reflect"
+	"regexp"
+	"strings"
 )
 
 type Config struct {
@@ -25,6 +27,30 @@ type Config struct {
 
 	// List of all avalible namespaces
 	Namespaces []Namespace `json:"namespaces" yaml:"namespaces"`
+
+	// Last version assigned to any of config entities
+	Version uint64 `json:"version" yaml:"version"`
+}
+
+// Returns next version for config entity
+func (c *Config) NextVersion() uint64 {
+	c.Version++
+	return c.Version
+}
+
+// Assigns new versions to all config entities, or only to entities without
+// version if all is false
+func (c *Config) SetVersions(all bool) {
+	lists := []interface{}{&c.Applications, &c.ApplicationGroups, &c.Templates, &c.Namespaces}
+	for _, list := range lists {
+		reflected := reflect.ValueOf(list).Elem()
+		for i := 0; i < reflected.Len(); i++ {
+			version := reflected.Index(i).FieldByName("Version")
+			if all || version.Uint() == 0 {
+				version.SetUint(c.NextVersion())
+			}
+		}
+	}
 }
 
 // Writes config to a file
@@ -50,38 +76,107 @@ func (c *Config) Load(reader io.Reader) error {
 		return err
 	}
 
+	c.SetVersions(false)
 	return nil
 }
 
+// Returns deep copy of config
+func (c *Config) Copy() (*Config, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
 type Template struct {
 	// Template name
 	Name string `json:"name" yaml:"name" description:"Template name"`
 
 	// Template content
 	Content string `json:"template" yaml:"template" description:"YAML or JSON formated kubernetes config template"`
+
+	// Declared template parameters
+	Parameters []Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty" description:"Declared tags of template"`
+
+	// Rolling update settings of applications using template
+	Rollout *RolloutStrategy `json:"rollout,omitempty" yaml:"rollout,omitempty" description:"Rolling update settings of applications using template as replication controller"`
+
+	// Template version
+	Version uint64 `json:"version" yaml:"version" description:"Version of template, required on update"`
 }
 
-// Generates config from template
-func (t *Template) Generate(client *client.Client, data map[string]string) (runtime.Object, string, error) {
+// Declared tag of template
+type Parameter struct {
+	// Tag name
+	Name string `json:"name" yaml:"name" description:"Tag name"`
+
+	// Tag description
+	Description string `json:"description,omitempty" yaml:"description,omitempty" description:"Tag description"`
+
+	// Whether tag must be set
+	Required bool `json:"required,omitempty" yaml:"required,omitempty" description:"Whether tag must be set even if template does not reference it"`
+
+	// Value used when tag is not set
+	Default *string `json:"default,omitempty" yaml:"default,omitempty" description:"Value used when tag is not set"`
+
+	// Regular expression value must fully match
+	Regex string `json:"regex,omitempty" yaml:"regex,omitempty" description:"Regular expression tag value must fully match"`
+}
+
+// Separator of YAML documents in a template
+var documentSeparator = regexp.MustCompile("(?m)^---[ \t]*$")
+
+// Generates objects from template, template can contain multiple YAML
+// documents separated by "---" or a List of objects and include partials
+func (t *Template) Generate(client *client.Client, data Tags, partials []Template) ([]runtime.Object, error) {
 	buf := new(bytes.Buffer)
 
-	tp, err := template.New("tpl").Parse(t.Content)
+	data, err := t.ResolveTags(data, partials)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
 
-	if tp.Execute(buf, data) != nil {
-		return nil, "", err
+	tp, err := parseTemplate(t.Name, t.Content, partials)
+	if err != nil {
+		return nil, err
 	}
 
-	obj, err := runtime.YAMLDecoder(client.Codec).Decode([]byte(buf.String()))
-	if err != nil {
-		return nil, "", err
+	if err := tp.Execute(buf, data); err != nil {
+		return nil, err
 	}
 
-	_, objKind, err := api.Scheme.ObjectVersionAndKind(obj)
+	objs := []runtime.Object{}
+	for _, doc := range documentSeparator.Split(buf.String(), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		obj, err := runtime.YAMLDecoder(client.Codec).Decode([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+
+		if list, ok := obj.(*api.List); ok {
+			objs = append(objs, list.Items...)
+		} else {
+			objs = append(objs, obj)
+		}
+	}
+
+	return objs, nil
+}
 
-	return obj, objKind, err
+// Returns kind of generated object
+func ObjectKind(obj runtime.Object) (string, error) {
+	_, kind, err := api.Scheme.ObjectVersionAndKind(obj)
+	return kind, err
 }
 
 type Application struct {
@@ -94,8 +189,33 @@ type Application struct {
 	// Service template name used by application
 	Service string `json:"service" yaml:"service" description:"Name of the service template"`
 
+	// Names of templates of any other kind used by application
+	Templates []string `json:"templates,omitempty" yaml:"templates,omitempty" description:"Names of templates of any supported kind used by application"`
+
 	// Application tags
-	Tags map[string]string `json:"tags" yaml:"tags" description:"Template tags associated with application"`
+	Tags Tags `json:"tags" yaml:"tags" description:"Template tags associated with application"`
+
+	// Applications that have to be deployed and ready before application
+	DependsOn []string `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty" description:"Names of applications that have to be deployed and ready before application"`
+
+	// Rolling update settings of application
+	Rollout *RolloutStrategy `json:"rollout,omitempty" yaml:"rollout,omitempty" description:"Rolling update settings of application, override settings of replication controller template"`
+
+	// Application version
+	Version uint64 `json:"version" yaml:"version" description:"Version of application, required on update"`
+}
+
+// Returns names of all templates used by application
+func (a *Application) TemplateNames() []string {
+	names := []string{}
+	if a.Service != "" {
+		names = append(names, a.Service)
+	}
+	if a.ReplicationController != "" {
+		names = append(names, a.ReplicationController)
+	}
+
+	return append(names, a.Templates...)
 }
 
 // Groups of applications
@@ -107,7 +227,10 @@ type ApplicationGroup struct {
 	Applications []string `json:"apps" yaml:"apps" description:"List of application names in group"`
 
 	// Application group tags
-	Tags map[string]string `json:"tags" yaml:"tags" description:"Template tags associated with application group"`
+	Tags Tags `json:"tags" yaml:"tags" description:"Template tags associated with application group"`
+
+	// Application group version
+	Version uint64 `json:"version" yaml:"version" description:"Version of application group, required on update"`
 }
 
 type Namespace struct {
@@ -118,5 +241,11 @@ type Namespace struct {
 	ApplicationGroup string `json:"group" yaml:"group" description:"Name of the application group associated with namespace"`
 
 	// Namespace tags
-	Tags map[string]string `json:"tags" yaml:"tags" description:"Template tags associated with namespace"`
+	Tags Tags `json:"tags" yaml:"tags" description:"Template tags associated with namespace"`
+
+	// Tags of applications overriden in namespace
+	Overrides map[string]Tags `json:"overrides,omitempty" yaml:"overrides,omitempty" description:"Tags by application name, that override application tags in namespace"`
+
+	// Namespace version
+	Version uint64 `json:"version" yaml:"version" description:"Version of namespace, required on update"`
 }
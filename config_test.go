@@ -15,18 +15,18 @@ func TestTemplate(t *testing.T) {
 	client, err := client.New(config)
 
 	content, err := ioutil.ReadFile("./test-service.yaml")
-	tpl := Template{"test", string(content)}
-	obj, kind, err := tpl.Generate(client, map[string]string{"name": "frontend"})
+	tpl := Template{Name: "test", Content: string(content)}
+	objs, err := tpl.Generate(client, Tags{"name": "frontend"}, nil)
 
 	if err != nil {
-		t.Errorf("expected success, got %v", err)
+		t.Fatalf("expected success, got %v", err)
 	}
 
-	if kind != "Service" {
+	if kind, _ := ObjectKind(objs[0]); kind != "Service" {
 		t.Errorf("expected Service kind, got %v", kind)
 	}
 
-	service := obj.(*api.Service)
+	service := objs[0].(*api.Service)
 	if service.Name != "frontend" {
 		t.Errorf("expected name frontend, got %v", service.Name)
 	}
@@ -36,6 +36,58 @@ func TestTemplate(t *testing.T) {
 	}
 }
 
+func TestTemplateMultipleDocuments(t *testing.T) {
+	client, _ := client.New(&client.Config{})
+
+	content, _ := ioutil.ReadFile("./test-service.yaml")
+	tpl := Template{Name: "test", Content: string(content) + "\n---\n" + string(content) + "\n---\n"}
+	objs, err := tpl.Generate(client, Tags{"name": "frontend"}, nil)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if len(objs) != 2 {
+		t.Errorf("expected 2 objects, got %v", len(objs))
+	}
+}
+
+func TestTemplateList(t *testing.T) {
+	client, _ := client.New(&client.Config{})
+
+	tpl := Template{Name: "test", Content: `
+kind: List
+apiVersion: v1beta3
+items:
+- kind: Secret
+  apiVersion: v1beta3
+  metadata:
+    name: {{.name}}
+- kind: Service
+  apiVersion: v1beta3
+  metadata:
+    name: {{.name}}
+  spec:
+    ports:
+    - port: 80
+`}
+	objs, err := tpl.Generate(client, Tags{"name": "frontend"}, nil)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if len(objs) != 2 {
+		t.Fatalf("expected 2 objects, got %v", len(objs))
+	}
+
+	if _, ok := objs[0].(*api.Secret); !ok {
+		t.Errorf("expected Secret, got %v", objs[0])
+	}
+
+	if _, ok := objs[1].(*api.Service); !ok {
+		t.Errorf("expected Service, got %v", objs[1])
+	}
+}
+
 func TestLoad(t *testing.T) {
 	buf := bytes.NewBuffer(nil)
 	f, _ := os.Open("test.yaml")
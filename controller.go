@@ -0,0 +1,176 @@
+package main
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/fields"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+	log "github.com/Sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// Drift between config and objects in the cluster
+type Drift struct {
+	// Time of last check
+	Checked time.Time `json:"checked" description:"Time of last drift check"`
+
+	// Time drift was last detected
+	Detected time.Time `json:"detected,omitempty" description:"Time drift was last detected"`
+
+	// Actions needed to fix the drift
+	Actions []Action `json:"actions" description:"Actions needed to bring cluster in sync with config"`
+}
+
+// Background controller that reconciles config when managed objects drift
+type Controller struct {
+	Process *Process
+
+	// Interval of periodic drift checks
+	Interval time.Duration
+
+	drift   Drift
+	mutex   sync.RWMutex
+	trigger chan struct{}
+}
+
+func NewController(process *Process, interval time.Duration) *Controller {
+	return &Controller{
+		Process:  process,
+		Interval: interval,
+		drift:    Drift{Actions: []Action{}},
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Returns last detected drift
+func (c *Controller) Drift() Drift {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.drift
+}
+
+// Runs controller until stop channel is closed
+func (c *Controller) Run(stop <-chan struct{}) {
+	log.Infof("Starting reconciliation controller with interval %v", c.Interval)
+
+	go c.watch(stop, "Namespace", func() (watch.Interface, error) {
+		selector, err := c.selector()
+		if err != nil {
+			return nil, err
+		}
+
+		return c.Process.Kube.Namespaces().Watch(selector, fields.Everything(), "")
+	})
+	for _, kind := range ManagedKinds {
+		kind := kind
+		go c.watch(stop, kind.Name, func() (watch.Interface, error) {
+			selector, err := c.selector()
+			if err != nil {
+				return nil, err
+			}
+
+			return kind.Watch(c.Process.Kube, selector)
+		})
+	}
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.check()
+		case <-c.trigger:
+			c.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Returns selector of objects managed for project of last committed
+// revision, watches get selector of current project when they restart
+func (c *Controller) selector() (labels.Selector, error) {
+	return labels.Parse("kubehub/enable=true,kubehub/project=" + c.Process.Project())
+}
+
+// Watches managed objects and triggers drift check on every change
+func (c *Controller) watch(stop <-chan struct{}, kind string, start func() (watch.Interface, error)) {
+	watchLogger := log.WithFields(log.Fields{"kind": kind})
+
+	for {
+		w, err := start()
+		if err != nil {
+			watchLogger.Errorf("Cannot watch objects %v", err)
+		} else {
+			c.forward(stop, w)
+			w.Stop()
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(c.Interval):
+		}
+	}
+}
+
+// Forwards watch events to drift checks, until watch or controller stops
+func (c *Controller) forward(stop <-chan struct{}, w watch.Interface) {
+	for {
+		select {
+		case _, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+
+			// Changes made by deployment itself are not a drift
+			if state, _, _ := c.Process.Status(); state == StateProcessing {
+				continue
+			}
+
+			// Multiple events are coalesced into a single check
+			select {
+			case c.trigger <- struct{}{}:
+			default:
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Checks for drift from config of last committed revision and reconciles
+// it if drift is detected
+func (c *Controller) check() {
+	if state, _, _ := c.Process.Status(); state == StateProcessing {
+		return
+	}
+
+	plan, err := c.Process.PlanReconcile()
+	if err != nil {
+		log.Errorf("Cannot check for drift %v", err)
+		return
+	}
+
+	actions := []Action{}
+	for _, action := range plan.Actions {
+		if action.Changes() {
+			actions = append(actions, action)
+		}
+	}
+
+	c.mutex.Lock()
+	c.drift.Checked = time.Now()
+	c.drift.Actions = actions
+	if len(actions) > 0 {
+		c.drift.Detected = c.drift.Checked
+	}
+	c.mutex.Unlock()
+
+	if len(actions) > 0 {
+		log.WithFields(log.Fields{"actions": len(actions)}).Warn("Drift detected, reconciling")
+		c.Process.Reconcile()
+	}
+}
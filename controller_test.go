@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconcileIgnoresUncommittedConfig(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+	p := newClusterProcess(t, kube, webConfig("v1", nil))
+	if err := p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	// Namespace removed through api, but not deployed
+	p.Config.Namespaces = []Namespace{}
+
+	c := NewController(p, time.Hour)
+	c.check()
+	if drift := c.Drift(); len(drift.Actions) != 0 {
+		t.Errorf("expected no drift from committed config, got %v", drift.Actions)
+	}
+
+	p.Reconcile()
+	for timeout := time.After(5 * time.Second); p.Queue().Running != nil; {
+		select {
+		case <-timeout:
+			t.Fatalf("expected queue to drain, got %+v", p.Queue())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if cluster.get("namespaces", "", "test-prod") == nil {
+		t.Errorf("expected reconciliation to keep namespace of committed config, got writes %v", cluster.writeLog())
+	}
+}
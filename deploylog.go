@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrDeployNotFound = errors.New("Deploy not found")
+
+// Deployment of config, either of a revision or reconciliation
+type Deploy struct {
+	// Deploy number
+	Id int `json:"id" yaml:"id" description:"Deploy number"`
+
+	// Deployed revision
+	Revision int `json:"revision,omitempty" yaml:"revision,omitempty" description:"Deployed revision, empty for reconciliation"`
+
+	// Time deployment started
+	Started time.Time `json:"started" yaml:"started" description:"Time deployment started, zero while queued"`
+
+	// Time deployment finished
+	Finished time.Time `json:"finished" yaml:"finished" description:"Time deployment finished, zero while processing"`
+
+	// Deployment state
+	State int `json:"state" yaml:"state" description:"Deployment state: 0 processing, 1 ready, 2 queued"`
+
+	// Deployment error
+	Error string `json:"err,omitempty" yaml:"err,omitempty" description:"Deployment error"`
+
+	// Requests coalesced into deployment
+	Requests []DeployRequest `json:"requests,omitempty" yaml:"requests,omitempty" description:"Requests coalesced into deployment"`
+}
+
+// Storage of deployments and their logs
+type DeployStore interface {
+	// Records new deployment under next id
+	Create(deploy *Deploy) error
+
+	// Updates deployment
+	Save(deploy *Deploy) error
+
+	// Lists all deployments ordered by id
+	List() ([]*Deploy, error)
+
+	// Gets deployment by id
+	Get(id int) (*Deploy, error)
+
+	// Appends entry to log of deployment
+	Append(id int, entry LogEntry) error
+
+	// Returns all log entries of deployment
+	Logs(id int) ([]LogEntry, error)
+}
+
+// Filter and page of deployment log entries
+type LogQuery struct {
+	// Only entries of namespace
+	Namespace string
+
+	// Only entries of app
+	App string
+
+	// Only entries of level or more severe
+	Level string
+
+	// Only entries logged after time
+	Since time.Time
+
+	// Number of matching entries to skip
+	Offset int
+
+	// Maximum number of entries returned
+	Limit int
+}
+
+// Page of deployment log entries
+type LogPage struct {
+	// Number of matching entries
+	Total int `json:"total" description:"Number of matching entries"`
+
+	// Number of skipped entries
+	Offset int `json:"offset" description:"Number of skipped entries"`
+
+	// Log entries
+	Entries []LogEntry `json:"entries" description:"Log entries"`
+}
+
+// Whether entry matches query filters
+func (q *LogQuery) Matches(entry LogEntry) bool {
+	if q.Namespace != "" && entry.Fields["namespace"] != q.Namespace {
+		return false
+	}
+
+	if q.App != "" && entry.Fields["app"] != q.App {
+		return false
+	}
+
+	if q.Level != "" {
+		level, err := log.ParseLevel(q.Level)
+		if err != nil {
+			return false
+		}
+
+		if entryLevel, err := log.ParseLevel(entry.Level); err != nil || entryLevel > level {
+			return false
+		}
+	}
+
+	return q.Since.IsZero() || entry.Time.After(q.Since)
+}
+
+// Returns page of log entries of deployment matching query
+func QueryLogs(store DeployStore, id int, query LogQuery) (*LogPage, error) {
+	entries, err := store.Logs(id)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &LogPage{Offset: query.Offset, Entries: []LogEntry{}}
+	for _, entry := range entries {
+		if !query.Matches(entry) {
+			continue
+		}
+
+		if page.Total >= query.Offset && (query.Limit <= 0 || len(page.Entries) < query.Limit) {
+			page.Entries = append(page.Entries, entry)
+		}
+		page.Total++
+	}
+
+	return page, nil
+}
+
+// Logrus hook that appends entries to log of deployment
+type DeployLogger struct {
+	Store DeployStore
+	Id    int
+}
+
+func (l *DeployLogger) Fire(entry *log.Entry) error {
+	return l.Store.Append(l.Id, NewLogEntry(entry))
+}
+
+func (l *DeployLogger) Levels() []log.Level {
+	return []log.Level{
+		log.PanicLevel,
+		log.FatalLevel,
+		log.ErrorLevel,
+		log.WarnLevel,
+		log.InfoLevel,
+		log.DebugLevel,
+	}
+}
+
+// Stores deployments as YAML files and their logs as files of JSON entries
+// in a directory, only the last Keep deployments are kept
+type FileDeployStore struct {
+	Dir  string
+	Keep int
+
+	mutex sync.Mutex
+}
+
+func NewFileDeployStore(dir string, keep int) *FileDeployStore {
+	return &FileDeployStore{Dir: dir, Keep: keep}
+}
+
+func (s *FileDeployStore) path(id int) string {
+	return filepath.Join(s.Dir, strconv.Itoa(id)+".yaml")
+}
+
+func (s *FileDeployStore) logPath(id int) string {
+	return filepath.Join(s.Dir, strconv.Itoa(id)+".log")
+}
+
+func (s *FileDeployStore) ids() ([]int, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, file := range files {
+		id, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".yaml"))
+		if err != nil || file.IsDir() {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (s *FileDeployStore) Create(deploy *Deploy) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+
+	deploy.Id = 1
+	if len(ids) > 0 {
+		deploy.Id = ids[len(ids)-1] + 1
+	}
+
+	if s.Keep > 0 {
+		for _, id := range ids {
+			if id > deploy.Id-s.Keep {
+				break
+			}
+
+			os.Remove(s.path(id))
+			os.Remove(s.logPath(id))
+		}
+	}
+
+	return s.save(deploy)
+}
+
+func (s *FileDeployStore) Save(deploy *Deploy) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.save(deploy)
+}
+
+func (s *FileDeployStore) save(deploy *Deploy) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(deploy)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path(deploy.Id), data, 0644)
+}
+
+func (s *FileDeployStore) List() ([]*Deploy, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	deploys := make([]*Deploy, 0, len(ids))
+	for _, id := range ids {
+		deploy, err := s.Get(id)
+		if err == ErrDeployNotFound {
+			// Removed after listing
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		deploys = append(deploys, deploy)
+	}
+
+	return deploys, nil
+}
+
+func (s *FileDeployStore) Get(id int) (*Deploy, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrDeployNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	deploy := &Deploy{}
+	if err := yaml.Unmarshal(data, deploy); err != nil {
+		return nil, err
+	}
+
+	return deploy, nil
+}
+
+func (s *FileDeployStore) Append(id int, entry LogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.OpenFile(s.logPath(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileDeployStore) Logs(id int) ([]LogEntry, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(s.logPath(id))
+	if os.IsNotExist(err) {
+		return []LogEntry{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []LogEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := LogEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
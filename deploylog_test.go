@@ -0,0 +1,135 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileDeployStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileDeployStore(dir+"/deploys", 2)
+
+	deploys, err := store.List()
+	if err != nil || len(deploys) != 0 {
+		t.Errorf("expected no deploys, got %v %v", deploys, err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		deploy := &Deploy{Revision: i, State: StateProcessing}
+		if err := store.Create(deploy); err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+		if deploy.Id != i {
+			t.Errorf("expected deploy %v, got %v", i, deploy.Id)
+		}
+
+		if err := store.Append(deploy.Id, LogEntry{Level: "info", Message: "Deploying"}); err != nil {
+			t.Errorf("expected success, got %v", err)
+		}
+	}
+
+	deploys, err = store.List()
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if len(deploys) != 2 || deploys[0].Id != 2 || deploys[1].Id != 3 {
+		t.Errorf("expected deploys 2, 3, got %v", deploys)
+	}
+
+	if _, err := store.Logs(1); err != ErrDeployNotFound {
+		t.Errorf("expected deploy not found, got %v", err)
+	}
+
+	deploy := deploys[1]
+	deploy.State = StateReady
+	deploy.Error = "failed"
+	if err := store.Save(deploy); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	deploy, err = store.Get(3)
+	if err != nil || deploy.Revision != 3 || deploy.State != StateReady || deploy.Error != "failed" {
+		t.Errorf("expected failed deploy of revision 3, got %v %v", deploy, err)
+	}
+
+	entries, err := store.Logs(3)
+	if err != nil || len(entries) != 1 || entries[0].Message != "Deploying" {
+		t.Errorf("expected one entry, got %v %v", entries, err)
+	}
+}
+
+func TestQueryLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileDeployStore(dir, 0)
+	deploy := &Deploy{}
+	if err := store.Create(deploy); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	logger := log.New()
+	logger.Level = log.DebugLevel
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(&DeployLogger{Store: store, Id: deploy.Id})
+
+	nsLogger := logger.WithFields(log.Fields{"namespace": "test-dev"})
+	nsLogger.Info("Creating namespace")
+	nsLogger.WithFields(log.Fields{"app": "guard"}).Debug("Creating service")
+	nsLogger.WithFields(log.Fields{"app": "guard"}).Error("Cannot create replication controller")
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	nsLogger.WithFields(log.Fields{"app": "nginx"}).Warn("Rolling back")
+	logger.WithFields(log.Fields{"namespace": "test-prod", "app": "guard"}).Info("Creating service")
+
+	for _, test := range []struct {
+		query    LogQuery
+		total    int
+		messages []string
+	}{
+		{LogQuery{}, 5, []string{"Creating namespace", "Creating service", "Cannot create replication controller", "Rolling back", "Creating service"}},
+		{LogQuery{Namespace: "test-dev", App: "guard"}, 2, []string{"Creating service", "Cannot create replication controller"}},
+		{LogQuery{App: "guard", Level: "info"}, 2, []string{"Cannot create replication controller", "Creating service"}},
+		{LogQuery{Level: "warning"}, 2, []string{"Cannot create replication controller", "Rolling back"}},
+		{LogQuery{Since: since}, 2, []string{"Rolling back", "Creating service"}},
+		{LogQuery{Offset: 1, Limit: 2}, 5, []string{"Creating service", "Cannot create replication controller"}},
+		{LogQuery{Namespace: "test-dev", Offset: 3}, 4, []string{"Rolling back"}},
+	} {
+		page, err := QueryLogs(store, deploy.Id, test.query)
+		if err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+
+		if page.Total != test.total || len(page.Entries) != len(test.messages) {
+			t.Errorf("expected %v of %v entries for %+v, got %v of %v", len(test.messages), test.total, test.query, len(page.Entries), page.Total)
+			continue
+		}
+
+		for i, entry := range page.Entries {
+			if entry.Message != test.messages[i] {
+				t.Errorf("expected entry %q for %+v, got %q", test.messages[i], test.query, entry.Message)
+			}
+		}
+	}
+
+	page, _ := QueryLogs(store, deploy.Id, LogQuery{App: "nginx"})
+	if entry := page.Entries[0]; entry.Level != "warning" || entry.Fields["namespace"] != "test-dev" || entry.Time.Before(since) {
+		t.Errorf("expected warning of test-dev after %v, got %+v", since, entry)
+	}
+
+	if _, err := QueryLogs(store, 2, LogQuery{}); err != ErrDeployNotFound {
+		t.Errorf("expected deploy not found, got %v", err)
+	}
+}
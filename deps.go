@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/wait"
+	"strings"
+	"time"
+)
+
+// Interval of polling app readiness
+const readyPollInterval = 2 * time.Second
+
+// Error of application dependencies
+type DependencyError struct {
+	App     string
+	Message string
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("Application %v %v", e.App, e.Message)
+}
+
+// Checks that applications depend only on existing applications and that
+// dependencies have no cycles
+func CheckDependencies(apps []Application) error {
+	names := []string{}
+	for _, app := range apps {
+		names = append(names, app.Name)
+	}
+
+	for _, app := range apps {
+		for _, dep := range app.DependsOn {
+			if _, ok := findApplication(apps, dep); !ok {
+				return &DependencyError{app.Name, "depends on unknown application " + dep}
+			}
+		}
+	}
+
+	_, err := SortApps(apps, names)
+	return err
+}
+
+// Sorts named applications so every application comes after its
+// dependencies, dependencies outside of named applications are ignored
+func SortApps(apps []Application, names []string) ([]string, error) {
+	included := map[string]bool{}
+	for _, name := range names {
+		included[name] = true
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	sorted := []string{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			return &DependencyError{name, "has dependency cycle " + strings.Join(append(path, name), " -> ")}
+		}
+
+		state[name] = visiting
+		app, _ := findApplication(apps, name)
+		for _, dep := range app.DependsOn {
+			if !included[dep] {
+				continue
+			}
+
+			if err := visit(dep, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		sorted = append(sorted, name)
+
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, []string{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+func findApplication(apps []Application, name string) (Application, bool) {
+	for _, app := range apps {
+		if app.Name == name {
+			return app, true
+		}
+	}
+
+	return Application{}, false
+}
+
+// Checks rollout settings and dependencies of application as if it was
+// written to config
+func (a *Application) Validate(config *Config) error {
+	if err := a.Rollout.Validate(); err != nil {
+		return err
+	}
+
+	apps := []Application{*a}
+	for _, app := range config.Applications {
+		if app.Name != a.Name {
+			apps = append(apps, app)
+		}
+	}
+
+	return CheckDependencies(apps)
+}
+
+// Waits until replication controllers of app have desired number of
+// replicas, all their pods are running and ready and services of app with
+// selector have endpoints
+func (p *Process) WaitReady(nsName, appName string, timeout time.Duration) error {
+	selector, err := labels.Parse("kubehub/enable=true,kubehub/name=" + appName)
+	if err != nil {
+		return err
+	}
+
+	rcs, err := p.Kube.ReplicationControllers(nsName).List(selector)
+	if err != nil {
+		return err
+	}
+
+	services, err := p.Kube.Services(nsName).List(selector)
+	if err != nil {
+		return err
+	}
+
+	return wait.Poll(readyPollInterval, timeout, func() (bool, error) {
+		for i := range rcs.Items {
+			if ok, err := p.controllerReady(nsName, &rcs.Items[i]); err != nil || !ok {
+				return false, err
+			}
+		}
+
+		for _, service := range services.Items {
+			if len(service.Spec.Selector) == 0 {
+				continue
+			}
+
+			endpoints, err := p.Kube.Endpoints(nsName).Get(service.Name)
+			if err != nil {
+				return false, err
+			}
+
+			if !EndpointsReady(endpoints) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	})
+}
+
+// Whether replication controller has desired number of replicas and all its
+// pods are running and ready
+func (p *Process) controllerReady(nsName string, rc *api.ReplicationController) (bool, error) {
+	if ok, err := client.ControllerHasDesiredReplicas(p.Kube, rc)(); err != nil || !ok {
+		return false, err
+	}
+
+	pods, err := p.Kube.Pods(nsName).List(labels.SelectorFromSet(rc.Spec.Selector))
+	if err != nil {
+		return false, err
+	}
+
+	for _, pod := range pods.Items {
+		if !PodReady(&pod) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Whether endpoints have at least one address
+func EndpointsReady(endpoints *api.Endpoints) bool {
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether pod is running and ready
+func PodReady(pod *api.Pod) bool {
+	if pod.Status.Phase != api.PodRunning {
+		return false
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == api.PodReady {
+			return condition.Status == api.ConditionTrue
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortApps(t *testing.T) {
+	apps := []Application{
+		{Name: "api", DependsOn: []string{"db", "cache"}},
+		{Name: "web", DependsOn: []string{"api"}},
+		{Name: "db"},
+		{Name: "cache", DependsOn: []string{"metrics"}},
+		{Name: "metrics"},
+	}
+
+	order, err := SortApps(apps, []string{"web", "api", "db", "cache"})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	// Metrics is not deployed, so cache does not wait for it
+	if expected := []string{"db", "cache", "api", "web"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected order %v, got %v", expected, order)
+	}
+
+	apps[2].DependsOn = []string{"web"}
+	if _, err := SortApps(apps, []string{"web", "api", "db"}); err == nil {
+		t.Errorf("expected cycle to be detected")
+	} else if err.Error() != "Application web has dependency cycle web -> api -> db -> web" {
+		t.Errorf("expected cycle in error, got %v", err)
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	config := &Config{Applications: []Application{{Name: "db"}, {Name: "api", DependsOn: []string{"db"}}}}
+	if err := CheckDependencies(config.Applications); err != nil {
+		t.Errorf("expected valid dependencies, got %v", err)
+	}
+
+	app := Application{Name: "db", DependsOn: []string{"api"}}
+	if _, ok := app.Validate(config).(*DependencyError); !ok {
+		t.Errorf("expected update of db to create a cycle")
+	}
+
+	app = Application{Name: "web", DependsOn: []string{"frontend"}}
+	if _, ok := app.Validate(config).(*DependencyError); !ok {
+		t.Errorf("expected unknown dependency error")
+	}
+}
+
+func TestPodReady(t *testing.T) {
+	pod := &api.Pod{Status: api.PodStatus{Phase: api.PodRunning}}
+	if PodReady(pod) {
+		t.Errorf("expected pod without ready condition not to be ready")
+	}
+
+	pod.Status.Conditions = []api.PodCondition{{Type: api.PodReady, Status: api.ConditionTrue}}
+	if !PodReady(pod) {
+		t.Errorf("expected running ready pod to be ready")
+	}
+}
+
+func TestEndpointsReady(t *testing.T) {
+	endpoints := &api.Endpoints{Subsets: []api.EndpointSubset{{Ports: []api.EndpointPort{{Port: 80}}}}}
+	if EndpointsReady(endpoints) {
+		t.Errorf("expected endpoints without addresses not to be ready")
+	}
+
+	endpoints.Subsets = append(endpoints.Subsets, api.EndpointSubset{Addresses: []api.EndpointAddress{{IP: "10.0.0.1"}}})
+	if !EndpointsReady(endpoints) {
+		t.Errorf("expected endpoints with address to be ready")
+	}
+}
+
+func TestFailedDependencyKeepsObjects(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+
+	config := webConfig("v2", nil)
+	config.Applications[0].DependsOn = []string{"db"}
+	config.Applications = append(config.Applications, Application{Name: "db", Templates: []string{"missing"}})
+	config.ApplicationGroups[0].Applications = []string{"db", "web"}
+	p := newClusterProcess(t, kube, config)
+
+	err := p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces))
+	if len(AppErrors(err)) != 2 {
+		t.Fatalf("expected db and web to fail, got %v", err)
+	}
+
+	if cluster.get("services", "test-prod", "web") == nil || cluster.get("replicationControllers", "test-prod", "web-v1") == nil {
+		t.Errorf("expected objects of skipped app to be kept")
+	}
+	for _, write := range cluster.writeLog() {
+		if !strings.HasPrefix(write, "PUT namespaces/") {
+			t.Errorf("expected objects of skipped app to be untouched, got %v", write)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Error of app deployment, app is empty for errors of namespace itself
+type AppError struct {
+	// Namespace name
+	Namespace string `json:"namespace" yaml:"namespace" description:"Namespace name"`
+
+	// Application name
+	App string `json:"app,omitempty" yaml:"app,omitempty" description:"Application name, empty for errors of namespace"`
+
+	// Error message
+	Message string `json:"err" yaml:"err" description:"Error message"`
+}
+
+func (e *AppError) Error() string {
+	if e.App == "" {
+		return fmt.Sprintf("%v: %v", e.Namespace, e.Message)
+	}
+
+	return fmt.Sprintf("%v/%v: %v", e.Namespace, e.App, e.Message)
+}
+
+// Errors of all apps that failed to deploy
+type DeployError struct {
+	Errors []*AppError
+
+	mutex sync.Mutex
+}
+
+func NewDeployError() *DeployError {
+	return &DeployError{Errors: []*AppError{}}
+}
+
+// Records error of app, errors of other deployments are merged
+func (e *DeployError) Add(namespace, app string, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if deployErr, ok := err.(*DeployError); ok {
+		e.Errors = append(e.Errors, deployErr.Errors...)
+		return
+	}
+
+	e.Errors = append(e.Errors, &AppError{Namespace: namespace, App: app, Message: err.Error()})
+}
+
+// Returns error if any app failed, nil otherwise
+func (e *DeployError) Err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+func (e *DeployError) Error() string {
+	messages := []string{}
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("Deployment of %v apps failed: %v", len(e.Errors), strings.Join(messages, "; "))
+}
+
+// Returns errors of deployment per app, empty if err is not a deployment
+// error
+func AppErrors(err error) []*AppError {
+	if deployErr, ok := err.(*DeployError); ok {
+		return deployErr.Errors
+	}
+
+	return []*AppError{}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	etcdErrorKeyNotFound = 100
+	etcdErrorTestFailed  = 101
+	etcdErrorNodeExists  = 105
+)
+
+// Error returned by etcd
+type EtcdError struct {
+	Code    int    `json:"errorCode"`
+	Message string `json:"message"`
+}
+
+func (e *EtcdError) Error() string {
+	return fmt.Sprintf("etcd error %v: %v", e.Code, e.Message)
+}
+
+// Node of etcd v2 keys api
+type etcdNode struct {
+	Key           string     `json:"key"`
+	Value         string     `json:"value"`
+	Dir           bool       `json:"dir"`
+	Nodes         []etcdNode `json:"nodes"`
+	ModifiedIndex uint64     `json:"modifiedIndex"`
+}
+
+type etcdResponse struct {
+	EtcdError
+	Node etcdNode `json:"node"`
+}
+
+// Minimal client for etcd v2 keys api
+type EtcdClient struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func NewEtcdClient(endpoint string) *EtcdClient {
+	return &EtcdClient{Endpoint: strings.TrimSuffix(endpoint, "/"), Client: http.DefaultClient}
+}
+
+func (c *EtcdClient) do(method, key string, params url.Values) (*etcdResponse, error) {
+	var body *bytes.Buffer
+	uri := c.Endpoint + path.Join("/v2/keys", key)
+
+	if method == "PUT" {
+		body = bytes.NewBufferString(params.Encode())
+	} else {
+		body = bytes.NewBuffer(nil)
+		uri = uri + "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	out := &etcdResponse{}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil, err
+	}
+
+	if out.Code != 0 {
+		return nil, &out.EtcdError
+	}
+
+	return out, nil
+}
+
+// Gets key or directory
+func (c *EtcdClient) Get(key string, recursive bool) (*etcdNode, error) {
+	res, err := c.do("GET", key, url.Values{"recursive": {strconv.FormatBool(recursive)}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Node, nil
+}
+
+// Sets key if it was not modified since index, or if it does not exist
+// when index is zero
+func (c *EtcdClient) CompareAndSwap(key, value string, index uint64) (*etcdNode, error) {
+	params := url.Values{"value": {value}}
+	if index == 0 {
+		params.Set("prevExist", "false")
+	} else {
+		params.Set("prevIndex", strconv.FormatUint(index, 10))
+	}
+
+	res, err := c.do("PUT", key, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &res.Node, nil
+}
+
+// Sets key unconditionally
+func (c *EtcdClient) Set(key, value string) error {
+	_, err := c.do("PUT", key, url.Values{"value": {value}})
+	return err
+}
+
+// Whether error is etcd error with any of the codes
+func isEtcdError(err error, codes ...int) bool {
+	etcdErr, ok := err.(*EtcdError)
+	if !ok {
+		return false
+	}
+
+	for _, code := range codes {
+		if etcdErr.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Stores config in etcd, using compare-and-swap on save
+type EtcdConfigStore struct {
+	Etcd   *EtcdClient
+	Prefix string
+
+	index uint64
+}
+
+func NewEtcdConfigStore(etcd *EtcdClient, prefix string) *EtcdConfigStore {
+	return &EtcdConfigStore{Etcd: etcd, Prefix: prefix}
+}
+
+func (s *EtcdConfigStore) Load(config *Config) error {
+	node, err := s.Etcd.Get(path.Join(s.Prefix, "config"), false)
+	if isEtcdError(err, etcdErrorKeyNotFound) {
+		return ErrConfigNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := config.Load(strings.NewReader(node.Value)); err != nil {
+		return err
+	}
+
+	s.index = node.ModifiedIndex
+	return nil
+}
+
+func (s *EtcdConfigStore) Save(config *Config) error {
+	buf := bytes.NewBuffer(nil)
+	if err := config.Commit(buf); err != nil {
+		return err
+	}
+
+	node, err := s.Etcd.CompareAndSwap(path.Join(s.Prefix, "config"), buf.String(), s.index)
+	if isEtcdError(err, etcdErrorTestFailed, etcdErrorNodeExists) {
+		return ErrConfigConflict
+	} else if err != nil {
+		return err
+	}
+
+	s.index = node.ModifiedIndex
+	return nil
+}
+
+// Stores revisions in etcd
+type EtcdRevisionStore struct {
+	Etcd   *EtcdClient
+	Prefix string
+}
+
+func NewEtcdRevisionStore(etcd *EtcdClient, prefix string) *EtcdRevisionStore {
+	return &EtcdRevisionStore{Etcd: etcd, Prefix: prefix}
+}
+
+func (s *EtcdRevisionStore) key(id int) string {
+	return path.Join(s.Prefix, "revisions", strconv.Itoa(id))
+}
+
+func (s *EtcdRevisionStore) List() ([]*Revision, error) {
+	dir, err := s.Etcd.Get(path.Join(s.Prefix, "revisions"), true)
+	if isEtcdError(err, etcdErrorKeyNotFound) {
+		return []*Revision{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*Revision, 0, len(dir.Nodes))
+	for _, node := range dir.Nodes {
+		rev := &Revision{}
+		if err := yaml.Unmarshal([]byte(node.Value), rev); err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+	sort.Sort(revisionsById(revisions))
+
+	return revisions, nil
+}
+
+// Returns highest id among keys of revisions, without decoding them
+func (s *EtcdRevisionStore) LastId() (int, error) {
+	dir, err := s.Etcd.Get(path.Join(s.Prefix, "revisions"), false)
+	if isEtcdError(err, etcdErrorKeyNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	last := 0
+	for _, node := range dir.Nodes {
+		if id, err := strconv.Atoi(path.Base(node.Key)); err == nil && id > last {
+			last = id
+		}
+	}
+
+	return last, nil
+}
+
+func (s *EtcdRevisionStore) Get(id int) (*Revision, error) {
+	node, err := s.Etcd.Get(s.key(id), false)
+	if isEtcdError(err, etcdErrorKeyNotFound) {
+		return nil, ErrRevisionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rev := &Revision{}
+	if err := yaml.Unmarshal([]byte(node.Value), rev); err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+func (s *EtcdRevisionStore) Save(rev *Revision) error {
+	data, err := yaml.Marshal(rev)
+	if err != nil {
+		return err
+	}
+
+	return s.Etcd.Set(s.key(rev.Id), string(data))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Fake etcd server supporting get and compare-and-swap of single keys
+func newFakeEtcd() *httptest.Server {
+	var mutex sync.Mutex
+	index := uint64(0)
+	nodes := map[string]etcdNode{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		key := strings.TrimPrefix(req.URL.Path, "/v2/keys")
+		node, exists := nodes[key]
+		req.ParseForm()
+
+		fail := func(code int) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			json.NewEncoder(w).Encode(EtcdError{Code: code, Message: "failed"})
+		}
+
+		switch req.Method {
+		case "GET":
+			if !exists {
+				fail(etcdErrorKeyNotFound)
+				return
+			}
+		case "PUT":
+			if req.Form.Get("prevExist") == "false" && exists {
+				fail(etcdErrorNodeExists)
+				return
+			}
+
+			if prevIndex := req.Form.Get("prevIndex"); prevIndex != "" {
+				if !exists || strconv.FormatUint(node.ModifiedIndex, 10) != prevIndex {
+					fail(etcdErrorTestFailed)
+					return
+				}
+			}
+
+			index++
+			node = etcdNode{Key: key, Value: req.Form.Get("value"), ModifiedIndex: index}
+			nodes[key] = node
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"node": node})
+	}))
+}
+
+func TestEtcdConfigStore(t *testing.T) {
+	server := newFakeEtcd()
+	defer server.Close()
+
+	store := NewEtcdConfigStore(NewEtcdClient(server.URL), "/kubehub")
+	if err := store.Load(&Config{}); err != ErrConfigNotFound {
+		t.Fatalf("expected config not found, got %v", err)
+	}
+
+	if err := store.Save(&Config{Project: "test"}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	other := NewEtcdConfigStore(NewEtcdClient(server.URL), "/kubehub")
+	config := &Config{}
+	if err := other.Load(config); err != nil || config.Project != "test" {
+		t.Fatalf("expected project test, got %v %v", config.Project, err)
+	}
+
+	if err := other.Save(&Config{Project: "other"}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if err := store.Save(&Config{Project: "stale"}); err != ErrConfigConflict {
+		t.Errorf("expected config conflict, got %v", err)
+	}
+
+	// Stale store keeps conflicting instead of replacing changed config
+	if err := store.Save(&Config{Project: "stale"}); err != ErrConfigConflict {
+		t.Errorf("expected second save of stale store to conflict, got %v", err)
+	}
+
+	config = &Config{}
+	if err := store.Load(config); err != nil || config.Project != "other" {
+		t.Fatalf("expected project other, got %v %v", config.Project, err)
+	}
+	if err := store.Save(&Config{Project: "reloaded"}); err != nil {
+		t.Errorf("expected save after reload to succeed, got %v", err)
+	}
+	if err := other.Save(&Config{Project: "other"}); err != ErrConfigConflict {
+		t.Errorf("expected other store to conflict, got %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Reasons of events recorded on kubernetes objects
+const (
+	EventCreated          = "KubehubCreated"
+	EventUpdated          = "KubehubUpdated"
+	EventRollingUpdate    = "KubehubRollingUpdate"
+	EventBlueGreen        = "KubehubBlueGreen"
+	EventCanary           = "KubehubCanary"
+	EventRolloutFailed    = "KubehubRolloutFailed"
+	EventGarbageCollected = "KubehubGarbageCollected"
+)
+
+// Maximum number of events waiting to be sent, further events are dropped
+const maxQueuedEvents = 1000
+
+// Records events about kubernetes objects
+type EventRecorder interface {
+	Event(ref *api.ObjectReference, reason, message string)
+}
+
+// Sends events to kubernetes in background, so deployment is not slowed
+// down by events
+type KubeEventRecorder struct {
+	kube  *client.Client
+	queue chan *api.Event
+}
+
+func NewKubeEventRecorder(kube *client.Client) *KubeEventRecorder {
+	recorder := &KubeEventRecorder{kube: kube, queue: make(chan *api.Event, maxQueuedEvents)}
+	go recorder.run()
+
+	return recorder
+}
+
+func (r *KubeEventRecorder) run() {
+	for event := range r.queue {
+		if _, err := r.kube.Events(event.Namespace).Create(event); err != nil {
+			log.WithFields(log.Fields{"reason": event.Reason, "object": event.InvolvedObject.Name}).Warnf("Cannot record event %v", err)
+		}
+	}
+}
+
+// Queues event about object, event is dropped if queue is full
+func (r *KubeEventRecorder) Event(ref *api.ObjectReference, reason, message string) {
+	now := util.Now()
+	event := &api.Event{
+		ObjectMeta: api.ObjectMeta{
+			Name:      fmt.Sprintf("%v.%x", ref.Name, now.UnixNano()),
+			Namespace: ref.Namespace,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		Source:         api.EventSource{Component: "kubehub"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	select {
+	case r.queue <- event:
+	default:
+		log.WithFields(log.Fields{"reason": reason, "object": ref.Name}).Warn("Event queue full, dropping event")
+	}
+}
+
+// Records applied action as event on affected object, actions that change
+// nothing are not recorded. Rolling updates are recorded on the new
+// replication controller. Events of namespaces are recorded in namespace
+// itself.
+func (p *Process) recordEvent(action Action, uid types.UID, err error) {
+	if p.Recorder == nil || !action.Changes() {
+		return
+	}
+
+	ref := &api.ObjectReference{
+		Kind:       action.Kind,
+		APIVersion: p.Kube.APIVersion(),
+		Namespace:  action.Namespace,
+		Name:       action.Name,
+		UID:        uid,
+	}
+	if action.Kind == "Namespace" {
+		ref.Namespace = action.Name
+	}
+
+	var reason, message string
+	switch action.Action {
+	case ActionCreate:
+		reason, message = EventCreated, "Created by kubehub"
+	case ActionUpdate:
+		reason, message = EventUpdated, "Updated by kubehub"
+	case ActionRollingUpdate:
+		reason, message = EventRollingUpdate, "Rolling updated by kubehub from "+action.Name
+	case ActionBlueGreen:
+		reason, message = EventBlueGreen, "Switched to by kubehub from "+action.Name
+	case ActionCanary:
+		reason, message = EventCanary, "Rolled out as canary by kubehub from "+action.Name
+	case ActionDelete:
+		reason, message = EventGarbageCollected, "Deleted by kubehub, no longer in config"
+	}
+
+	if action.To != "" {
+		ref.Name = action.To
+	}
+	if err != nil {
+		reason, message = EventRolloutFailed, fmt.Sprintf("Rollout by kubehub from %v failed: %v", action.Name, err)
+	}
+	if action.App != "" {
+		message += fmt.Sprintf(" (app %v)", action.App)
+	}
+
+	p.Recorder.Event(ref, reason, message)
+}
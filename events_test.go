@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
+	"testing"
+)
+
+type fakeRecorder struct {
+	events []api.Event
+}
+
+func (r *fakeRecorder) Event(ref *api.ObjectReference, reason, message string) {
+	r.events = append(r.events, api.Event{InvolvedObject: *ref, Reason: reason, Message: message})
+}
+
+func TestRecordEvent(t *testing.T) {
+	kube, _ := client.New(&client.Config{Host: "http://localhost", Version: "v1beta3"})
+	recorder := &fakeRecorder{}
+	p := &Process{Kube: kube, Recorder: recorder}
+
+	p.recordEvent(Action{Action: ActionCreate, Kind: "Namespace", Name: "test-prod"}, types.UID("1"), nil)
+	p.recordEvent(Action{Action: ActionUpdate, Kind: "Service", Namespace: "test-prod", Name: "api"}, types.UID("2"), nil)
+	p.recordEvent(Action{
+		Action: ActionRollingUpdate, Kind: "ReplicationController", Namespace: "test-prod",
+		Name: "api-v1", To: "api-v2", App: "api",
+	}, types.UID("3"), nil)
+	p.recordEvent(Action{Action: ActionCanary, Kind: "ReplicationController", Namespace: "test-prod", Name: "api-v1"}, types.UID("4"), errors.New("aborted"))
+	p.recordEvent(Action{Action: ActionDelete, Kind: "Secret", Namespace: "test-prod", Name: "old"}, types.UID("5"), nil)
+
+	// Update without diff is not recorded
+	expected := []struct {
+		namespace, name, reason, message string
+	}{
+		{"test-prod", "test-prod", EventCreated, "Created by kubehub"},
+		{"test-prod", "api-v2", EventRollingUpdate, "Rolling updated by kubehub from api-v1 (app api)"},
+		{"test-prod", "api-v1", EventRolloutFailed, "Rollout by kubehub from api-v1 failed: aborted"},
+		{"test-prod", "old", EventGarbageCollected, "Deleted by kubehub, no longer in config"},
+	}
+	if len(recorder.events) != len(expected) {
+		t.Fatalf("expected %v events, got %v", len(expected), recorder.events)
+	}
+
+	for i, event := range recorder.events {
+		ref := event.InvolvedObject
+		if ref.Namespace != expected[i].namespace || ref.Name != expected[i].name ||
+			event.Reason != expected[i].reason || event.Message != expected[i].message {
+			t.Errorf("expected event %v, got %v %v %v %v", expected[i], ref.Namespace, ref.Name, event.Reason, event.Message)
+		}
+	}
+}
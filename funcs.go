@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// Maximum depth of nested includes, protects against include loops
+const maxIncludeDepth = 16
+
+// Returns functions available in templates, include renders named template
+// defined in tp or any of partials, depth counts nested includes
+func templateFuncs(tp **template.Template, partials []Template, depth *int) template.FuncMap {
+	return template.FuncMap{
+		// Strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       func(sep string, elems []string) string { return strings.Join(elems, sep) },
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"trunc":      truncate,
+		"quote":      func(s interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(s)) },
+
+		// Defaulting
+		"default":  defaultValue,
+		"required": requiredValue,
+		"empty":    isEmpty,
+
+		// Encoding and hashing
+		"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec": func(s string) (string, error) {
+			data, err := base64.StdEncoding.DecodeString(s)
+			return string(data), err
+		},
+		"sha256": func(s string) string {
+			sum := sha256.Sum256([]byte(s))
+			return hex.EncodeToString(sum[:])
+		},
+		"toYaml": toYaml,
+		"toJson": toJson,
+		"indent": indent,
+		"nindent": func(spaces int, s string) string {
+			return "\n" + indent(spaces, s)
+		},
+
+		// Partials
+		"include": func(name string, data interface{}) (string, error) {
+			return include(*tp, partials, depth, name, data)
+		},
+	}
+}
+
+// Renders template defined in tp, or template from partials
+func include(tp *template.Template, partials []Template, depth *int, name string, data interface{}) (string, error) {
+	if *depth >= maxIncludeDepth {
+		return "", fmt.Errorf("Template %v included too deep", name)
+	}
+	*depth++
+	defer func() { *depth-- }()
+
+	buf := new(bytes.Buffer)
+	if tp.Lookup(name) != nil {
+		err := tp.ExecuteTemplate(buf, name, data)
+		return buf.String(), err
+	}
+
+	for _, partial := range partials {
+		if partial.Name != name {
+			continue
+		}
+
+		ptp, err := newTemplate(partial.Name, partial.Content, partials, depth)
+		if err != nil {
+			return "", err
+		}
+
+		err = ptp.Execute(buf, data)
+		return buf.String(), err
+	}
+
+	return "", fmt.Errorf("Included template %v not found", name)
+}
+
+// Parses template content with function library
+func parseTemplate(name, content string, partials []Template) (*template.Template, error) {
+	depth := 0
+	return newTemplate(name, content, partials, &depth)
+}
+
+func newTemplate(name, content string, partials []Template, depth *int) (*template.Template, error) {
+	tp := template.New(name).Option("missingkey=error")
+	tp.Funcs(templateFuncs(&tp, partials, depth))
+
+	return tp.Parse(content)
+}
+
+// Whether value is nil or zero value of its type
+func isEmpty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return reflect.DeepEqual(value, reflect.Zero(v.Type()).Interface())
+}
+
+// Returns value, or def if value is empty
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || isEmpty(value[0]) {
+		return def
+	}
+
+	return value[0]
+}
+
+// Returns value, fails rendering with message if value is empty
+func requiredValue(message string, value interface{}) (interface{}, error) {
+	if isEmpty(value) {
+		return nil, errors.New(message)
+	}
+
+	return value, nil
+}
+
+func truncate(length int, s string) string {
+	if len(s) <= length {
+		return s
+	}
+
+	return s[:length]
+}
+
+func toYaml(value interface{}) (string, error) {
+	data, err := yaml.Marshal(value)
+	return strings.TrimSuffix(string(data), "\n"), err
+}
+
+func toJson(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// Indents every line of s by number of spaces
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	partials := []Template{
+		{Name: "labels", Content: "app: {{.name}}\nenv: {{.env | default \"dev\"}}"},
+		{Name: "loop", Content: `{{include "loop" .}}`},
+	}
+
+	tests := []struct {
+		content  string
+		data     map[string]string
+		expected string
+	}{
+		{`{{.name | upper}} {{trimPrefix "web-" .name}} {{replace "-" "_" .name}}`, map[string]string{"name": "web-api"}, "WEB-API api web_api"},
+		{`{{default "dev" .env}} {{default "dev" ""}}`, map[string]string{"env": "prod"}, "prod dev"},
+		{`{{.password | b64enc}}`, map[string]string{"password": "secret"}, "c2VjcmV0"},
+		{`{{sha256 "a"}}`, map[string]string{}, "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"},
+		{`{{toYaml . | indent 2}}`, map[string]string{"a": "1"}, `  a: "1"`},
+		{"labels:\n{{include \"labels\" . | indent 2}}", map[string]string{"name": "web", "env": ""}, "labels:\n  app: web\n  env: dev"},
+		{`{{define "x"}}[{{.name}}]{{end}}{{include "x" . | trim}}`, map[string]string{"name": "web"}, "[web]"},
+	}
+
+	for _, test := range tests {
+		tp, err := parseTemplate("test", test.content, partials)
+		if err != nil {
+			t.Fatalf("expected %q to parse, got %v", test.content, err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := tp.Execute(buf, test.data); err != nil {
+			t.Errorf("expected %q to render, got %v", test.content, err)
+		} else if buf.String() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, buf.String())
+		}
+	}
+
+	failing := []string{
+		`{{required "image tag must be set" .tag}}`,
+		`{{include "missing" .}}`,
+		`{{include "loop" .}}`,
+	}
+	for _, content := range failing {
+		tp, _ := parseTemplate("test", content, partials)
+		if err := tp.Execute(new(bytes.Buffer), map[string]string{"tag": ""}); err == nil {
+			t.Errorf("expected %q to fail", content)
+		}
+	}
+}
+
+func TestTemplateOptionalVariables(t *testing.T) {
+	partials := []Template{{Name: "labels", Content: "app: {{.name}}\nenv: {{.env | default \"dev\"}}"}}
+	tpl := Template{Name: "test", Content: `{{include "labels" .}} {{default "1" .replicas}}`}
+
+	variables, err := tpl.variables(partials)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if len(variables) != 3 || !variables["name"] || variables["env"] || variables["replicas"] {
+		t.Errorf("expected required name and optional env and replicas, got %v", variables)
+	}
+
+	tags, err := tpl.ResolveTags(Tags{"name": "web"}, partials)
+	if err != nil {
+		t.Fatalf("expected optional tags to resolve, got %v", err)
+	}
+
+	if value, ok := tags["env"]; !ok || value != "" {
+		t.Errorf("expected optional env tag to be empty, got %v", tags)
+	}
+}
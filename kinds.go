@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+	"reflect"
+)
+
+// Kind of kubernetes object that can be managed by kubehub
+type Kind struct {
+	// Kind name as returned by template
+	Name string
+
+	// Kubernetes api resource name
+	Resource string
+}
+
+// All kinds of objects kubehub can manage inside namespace, in order of creation
+var ManagedKinds = []Kind{
+	{"Secret", "secrets"},
+	{"ResourceQuota", "resourceQuotas"},
+	{"LimitRange", "limitRanges"},
+	{"PersistentVolumeClaim", "persistentVolumeClaims"},
+	{"Endpoints", "endpoints"},
+	{"Service", "services"},
+	{"ReplicationController", "replicationControllers"},
+	{"Pod", "pods"},
+}
+
+// Finds managed kind by name
+func FindKind(name string) (Kind, error) {
+	for _, kind := range ManagedKinds {
+		if kind.Name == name {
+			return kind, nil
+		}
+	}
+
+	return Kind{}, fmt.Errorf("Unsupported kind %v", name)
+}
+
+// Lists objects of kind in namespace
+func (k Kind) List(kube *client.Client, ns string, selector labels.Selector) ([]runtime.Object, error) {
+	list, err := kube.Get().Namespace(ns).Resource(k.Resource).LabelsSelectorParam(selector).Do().Get()
+	if err != nil {
+		return nil, err
+	}
+
+	return runtime.ExtractList(list)
+}
+
+// Creates object of kind in namespace, obj is updated with created object
+func (k Kind) Create(kube *client.Client, ns string, obj runtime.Object) error {
+	return kube.Post().Namespace(ns).Resource(k.Resource).Body(obj).Do().Into(obj)
+}
+
+// Updates object of kind in namespace
+func (k Kind) Update(kube *client.Client, ns string, obj runtime.Object) error {
+	meta, err := api.ObjectMetaFor(obj)
+	if err != nil {
+		return err
+	}
+
+	return kube.Put().Namespace(ns).Resource(k.Resource).Name(meta.Name).Body(obj).Do().Error()
+}
+
+// Watches objects of kind in all namespaces
+func (k Kind) Watch(kube *client.Client, selector labels.Selector) (watch.Interface, error) {
+	return kube.Get().Prefix("watch").Resource(k.Resource).LabelsSelectorParam(selector).Watch()
+}
+
+// Deletes object of kind from namespace
+func (k Kind) Delete(kube *client.Client, ns string, name string) error {
+	return kube.Delete().Namespace(ns).Resource(k.Resource).Name(name).Do().Error()
+}
+
+// Copies spec fields populated by the cluster from live object to rendered
+// object that leaves them unset, so they are not reported as drift
+func CopyServerFields(live, rendered runtime.Object) {
+	switch rendered := rendered.(type) {
+	case *api.Pod:
+		if livePod, ok := live.(*api.Pod); ok && rendered.Spec.Host == "" {
+			rendered.Spec.Host = livePod.Spec.Host
+		}
+	}
+}
+
+// Copies status of live object to rendered object, so only specs are compared
+func CopyStatus(live, rendered runtime.Object) {
+	liveStatus := reflect.ValueOf(live).Elem().FieldByName("Status")
+	renderedStatus := reflect.ValueOf(rendered).Elem().FieldByName("Status")
+	if liveStatus.IsValid() && renderedStatus.IsValid() && liveStatus.Type() == renderedStatus.Type() {
+		renderedStatus.Set(liveStatus)
+	}
+}
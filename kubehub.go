@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
 	log "github.com/Sirupsen/logrus"
 	"os"
@@ -36,17 +37,152 @@ func main() {
 	client, _ := client.New(cfg)
 	config := &Config{}
 
-	process, err := NewProcess(client, config, options.File)
+	store, revisions, err := newStores(client, &options)
+	if err != nil {
+		log.Errorf("Problem creating storage %v", err)
+		os.Exit(1)
+	}
+
+	process, err := NewProcess(client, config, store, revisions)
 	if err != nil {
 		log.Errorf("Problem creating process %v", err)
 		os.Exit(1)
 	}
+	process.ReadyTimeout = options.Ready
+	process.WaitForReady = options.WaitReady
+	process.SetConcurrency(options.Workers, options.NsWorkers)
+	process.ParallelNamespaces = options.Namespaces
+	if !options.NoEvents {
+		process.Recorder = NewKubeEventRecorder(client)
+	}
+	process.Deploys, err = newDeployStore(&options)
+	if err != nil {
+		log.Errorf("Problem creating deploy storage %v", err)
+		os.Exit(1)
+	}
 
 	api, err := NewApi(process)
 	if err != nil {
-		log.Error("Problem creating api %v", err)
+		log.Errorf("Problem creating api %v", err)
+		os.Exit(1)
+	}
+
+	api.Auth, err = newAuth(&options.Auth)
+	if err != nil {
+		log.Errorf("Problem creating authentication %v", err)
 		os.Exit(1)
 	}
 
+	if options.Reconcile > 0 {
+		api.Controller = NewController(process, options.Reconcile)
+		go api.Controller.Run(make(chan struct{}))
+	}
+
 	api.Serve(":8081")
 }
+
+// Creates config and revision storage, config is imported from config file
+// if storage is not file based and is empty
+func newStores(kube *client.Client, options *Options) (ConfigStore, RevisionStore, error) {
+	var store ConfigStore
+	var revisions RevisionStore
+
+	switch options.Store.Backend {
+	case "file":
+		store = NewFileConfigStore(options.File)
+		revisions = NewFileRevisionStore(options.File + ".revisions")
+		if options.Revisions != "" {
+			revisions = NewFileRevisionStore(options.Revisions)
+		}
+		return store, revisions, nil
+	case "cluster":
+		store = NewSecretConfigStore(kube, options.Store.Namespace, options.Store.Name)
+		revisions = NewSecretRevisionStore(kube, options.Store.Namespace, options.Store.Name)
+	case "etcd":
+		etcd := NewEtcdClient(options.Store.Etcd)
+		store = NewEtcdConfigStore(etcd, options.Store.Prefix)
+		revisions = NewEtcdRevisionStore(etcd, options.Store.Prefix)
+	default:
+		return nil, nil, errors.New("Unknown storage backend " + options.Store.Backend)
+	}
+
+	if options.File == "" {
+		return store, revisions, nil
+	}
+
+	if err := store.Load(&Config{}); err != ErrConfigNotFound {
+		return store, revisions, err
+	}
+
+	log.Infof("Importing config file %v", options.File)
+	config := &Config{}
+	if err := NewFileConfigStore(options.File).Load(config); err != nil {
+		return nil, nil, err
+	}
+
+	return store, revisions, store.Save(config)
+}
+
+// Creates storage of deployments, unless config is stored in a file, deploy
+// logs directory must be set explicitly, so history and deploy numbers
+// persist across restarts like config and revisions do
+func newDeployStore(options *Options) (DeployStore, error) {
+	if options.Store.Backend != "file" && options.DeployLogs == "" {
+		return nil, errors.New("Deploy logs directory on persistent volume must be set with --deploy_logs for storage backend " + options.Store.Backend)
+	}
+
+	return NewFileDeployStore(deployLogsDir(options), options.KeepLogs), nil
+}
+
+// Returns directory of deploy logs, next to config file unless set
+func deployLogsDir(options *Options) string {
+	if options.DeployLogs != "" {
+		return options.DeployLogs
+	} else if options.File != "" {
+		return options.File + ".deploys"
+	}
+
+	return "kubehub.deploys"
+}
+
+// Creates authentication from options, authentication is disabled if no
+// authenticator is configured
+func newAuth(options *AuthOptions) (*Auth, error) {
+	auth := &Auth{Users: make(map[string]*User)}
+
+	if options.Tokens != "" {
+		authenticator, err := NewTokenAuthenticator(options.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators, authenticator)
+	}
+
+	if options.Htpasswd != "" {
+		authenticator, err := NewHtpasswdAuthenticator(options.Htpasswd)
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators, authenticator)
+	}
+
+	if options.JWTKey != "" {
+		authenticator, err := NewJWTAuthenticator(options.JWTKey)
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators, authenticator)
+	}
+
+	if options.Policy != "" {
+		if err := auth.LoadPolicy(options.Policy); err != nil {
+			return nil, err
+		}
+	}
+
+	if !auth.Enabled() {
+		log.Warn("Authentication is disabled, everyone is admin")
+	}
+
+	return auth, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"github.com/emicklei/go-restful"
+	"github.com/prometheus/client_golang/prometheus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+var (
+	deploysTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubehub",
+		Name:      "deploys_total",
+		Help:      "Number of deployments by outcome.",
+	}, []string{"outcome"})
+
+	deployDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kubehub",
+		Name:      "deploy_duration_seconds",
+		Help:      "Duration of deployments by outcome.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"outcome"})
+
+	namespaceReconcilesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubehub",
+		Name:      "namespace_reconciles_total",
+		Help:      "Number of namespace reconciliations by namespace and outcome.",
+	}, []string{"namespace", "outcome"})
+
+	appReconcilesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubehub",
+		Name:      "app_reconciles_total",
+		Help:      "Number of app reconciliations by namespace, app and outcome.",
+	}, []string{"namespace", "app", "outcome"})
+
+	objectActionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubehub",
+		Name:      "object_actions_total",
+		Help:      "Number of actions applied to kubernetes objects by kind and action.",
+	}, []string{"kind", "action"})
+
+	rolloutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kubehub",
+		Name:      "rollout_duration_seconds",
+		Help:      "Duration of rollouts of replication controllers by type and outcome.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"type", "outcome"})
+
+	newtagHooksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubehub",
+		Name:      "newtag_hooks_total",
+		Help:      "Number of newtag hook invocations by result.",
+	}, []string{"result"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "kubehub",
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of api requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+)
+
+func init() {
+	prometheus.MustRegister(deploysTotal)
+	prometheus.MustRegister(deployDuration)
+	prometheus.MustRegister(namespaceReconcilesTotal)
+	prometheus.MustRegister(appReconcilesTotal)
+	prometheus.MustRegister(objectActionsTotal)
+	prometheus.MustRegister(rolloutDuration)
+	prometheus.MustRegister(newtagHooksTotal)
+	prometheus.MustRegister(apiRequestDuration)
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeFailure
+	}
+
+	return OutcomeSuccess
+}
+
+// Records metrics of finished deployment, its applied actions and results
+// of namespaces and apps
+func recordDeploy(started time.Time, err error, plan *Plan, status *DeployStatus) {
+	deploysTotal.WithLabelValues(outcome(err)).Inc()
+	deployDuration.WithLabelValues(outcome(err)).Observe(time.Since(started).Seconds())
+
+	for _, action := range plan.Actions {
+		if action.Changes() {
+			objectActionsTotal.WithLabelValues(action.Kind, action.Action).Inc()
+		}
+	}
+
+	for _, ns := range status.Namespaces() {
+		namespaceReconcilesTotal.WithLabelValues(ns.Name, deployOutcome(ns.State)).Inc()
+		for _, app := range ns.Apps {
+			appReconcilesTotal.WithLabelValues(ns.Name, app.Name, deployOutcome(app.State)).Inc()
+		}
+	}
+}
+
+func deployOutcome(state string) string {
+	if state == DeploySucceeded {
+		return OutcomeSuccess
+	}
+
+	return OutcomeFailure
+}
+
+// Records duration of rollout of replication controller
+func recordRollout(rolloutType string, started time.Time, err error) {
+	rolloutDuration.WithLabelValues(rolloutType, outcome(err)).Observe(time.Since(started).Seconds())
+}
+
+// Measures latency of api requests, route is request path with values of
+// path parameters replaced by their names
+func (api *Api) measure(req *restful.Request, res *restful.Response, chain *restful.FilterChain) {
+	started := time.Now()
+	chain.ProcessFilter(req, res)
+
+	apiRequestDuration.WithLabelValues(
+		requestRoute(req), req.Request.Method, strconv.Itoa(res.StatusCode()),
+	).Observe(time.Since(started).Seconds())
+}
+
+func requestRoute(req *restful.Request) string {
+	segments := strings.Split(req.Request.URL.Path, "/")
+	for i, segment := range segments {
+		for name, value := range req.PathParameters() {
+			if segment != "" && segment == value {
+				segments[i] = "{" + name + "}"
+			}
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
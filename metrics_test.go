@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"github.com/emicklei/go-restful"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestRoute(t *testing.T) {
+	httpReq, _ := http.NewRequest("GET", "/namespaces/prod/apps/api/tags", nil)
+	req := restful.NewRequest(httpReq)
+	req.PathParameters()["name"] = "prod"
+	req.PathParameters()["app"] = "api"
+
+	if route := requestRoute(req); route != "/namespaces/{name}/apps/{app}/tags" {
+		t.Errorf("unexpected route %v", route)
+	}
+}
+
+func TestRecordDeploy(t *testing.T) {
+	plan := NewPlan(false)
+	plan.Add(Action{Action: ActionCreate, Kind: "Secret", Name: "metrics-test"})
+	plan.Add(Action{Action: ActionUpdate, Kind: "Secret", Name: "metrics-test"})
+
+	status := NewDeployStatus([]Namespace{{Name: "metrics-test"}})
+	status.AddApp("metrics-test", "api", time.Now(), "", errors.New("failed"))
+	status.Finish("metrics-test", errors.New("failed"))
+
+	recordDeploy(time.Now(), errors.New("failed"), plan, status)
+
+	counters := map[string]*dto.Metric{
+		"created":   {},
+		"updated":   {},
+		"namespace": {},
+		"app":       {},
+	}
+	objectActionsTotal.WithLabelValues("Secret", ActionCreate).Write(counters["created"])
+	objectActionsTotal.WithLabelValues("Secret", ActionUpdate).Write(counters["updated"])
+	namespaceReconcilesTotal.WithLabelValues("metrics-test", OutcomeFailure).Write(counters["namespace"])
+	appReconcilesTotal.WithLabelValues("metrics-test", "api", OutcomeFailure).Write(counters["app"])
+
+	// Update without diff does not change anything
+	expected := map[string]float64{"created": 1, "updated": 0, "namespace": 1, "app": 1}
+	for name, metric := range counters {
+		if value := metric.GetCounter().GetValue(); value != expected[name] {
+			t.Errorf("expected %v counter %v, got %v", name, expected[name], value)
+		}
+	}
+}
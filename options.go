@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/jessevdk/go-flags"
+	"time"
 )
 
 type KubernetesOptions struct {
@@ -14,11 +15,38 @@ type KubernetesOptions struct {
 	//Key      string `toml:"key" long:"key" description:"Key"`
 }
 
+type StoreOptions struct {
+	Backend   string `long:"backend" description:"Config storage backend file/cluster/etcd" default:"file"`
+	Namespace string `long:"namespace" description:"Namespace where cluster backend stores config" default:"kubehub"`
+	Name      string `long:"name" description:"Name of secret where cluster backend stores config" default:"kubehub-config"`
+	Etcd      string `long:"etcd" description:"Etcd endpoint used by etcd backend" default:"http://localhost:4001"`
+	Prefix    string `long:"prefix" description:"Key prefix used by etcd backend" default:"/kubehub"`
+}
+
+type AuthOptions struct {
+	Tokens   string `long:"tokens" description:"File with token,user lines of static bearer tokens" value-name:"FILE"`
+	Htpasswd string `long:"htpasswd" description:"Htpasswd file for http basic authentication" value-name:"FILE"`
+	JWTKey   string `long:"jwt_key" description:"HS256 secret or RS256 PEM public key for JWT bearer tokens" value-name:"FILE"`
+	Policy   string `long:"policy" description:"YAML file with user roles" value-name:"FILE"`
+}
+
 type Options struct {
 	Kubernetes KubernetesOptions `group:"Kubernetes Options" namespace:"kube"`
+	Store      StoreOptions      `group:"Storage Options" namespace:"store"`
+	Auth       AuthOptions       `group:"Authentication Options" namespace:"auth"`
 	LogLevel   string            `short:"v" long:"log_level" description:"Loglevel panic/fatal/error/warn/info/debug" default:"info"`
-	File       string            `short:"c" long:"config" description:"Config file" value-name:"FILE"`
+	File       string            `short:"c" long:"config" description:"Config file, imported into storage if storage is empty" value-name:"FILE"`
 	Host       string            `short:"h" long:"host" description:"Host where to serve" value-name:"HOST" default:":8081"`
+	Revisions  string            `long:"revisions" description:"Directory where file backend stores revisions, defaults to config file with .revisions suffix" value-name:"DIR"`
+	Reconcile  time.Duration     `long:"reconcile_interval" description:"Interval of background reconciliation, disabled if zero" value-name:"DURATION" default:"0"`
+	Ready      time.Duration     `long:"ready_timeout" description:"How long to wait for app to become ready" value-name:"DURATION" default:"5m"`
+	WaitReady  bool              `long:"wait_ready" description:"Wait for pods of every app to become ready before deployment succeeds"`
+	Workers    int               `long:"concurrency" description:"Number of apps deployed at once across all namespaces" value-name:"N" default:"8"`
+	NsWorkers  int               `long:"namespace_concurrency" description:"Number of apps deployed at once per namespace" value-name:"N" default:"4"`
+	Namespaces int               `long:"parallel_namespaces" description:"Number of namespaces deployed at once" value-name:"N" default:"4"`
+	NoEvents   bool              `long:"disable_events" description:"Do not record actions as kubernetes events"`
+	DeployLogs string            `long:"deploy_logs" description:"Directory where deployments and their logs are stored, defaults to config file with .deploys suffix, required unless storage backend is file" value-name:"DIR"`
+	KeepLogs   int               `long:"deploy_logs_keep" description:"Number of most recent deployments whose logs are kept" value-name:"N" default:"500"`
 }
 
 func (o *Options) Parse() error {
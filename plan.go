@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
+	"sync"
+)
+
+const (
+	ActionCreate        = "create"
+	ActionUpdate        = "update"
+	ActionRollingUpdate = "rolling-update"
+	ActionBlueGreen     = "blue-green"
+	ActionCanary        = "canary"
+	ActionDelete        = "delete"
+)
+
+// Action performed (or to be performed) on a kubernetes object
+type Action struct {
+	// Type of action
+	Action string `json:"action" description:"Type of action: create, update, rolling-update, blue-green, canary or delete"`
+
+	// Kind of kubernetes object
+	Kind string `json:"kind" description:"Kind of kubernetes object"`
+
+	// Kubernetes namespace of object
+	Namespace string `json:"namespace,omitempty" description:"Kubernetes namespace of object"`
+
+	// Name of kubernetes object
+	Name string `json:"name" description:"Name of kubernetes object"`
+
+	// Application that owns object
+	App string `json:"app,omitempty" description:"Name of the application object belongs to"`
+
+	// New name of object on rolling update
+	To string `json:"to,omitempty" description:"Name of the new replication controller on rolling update, blue-green or canary"`
+
+	// Difference between live and rendered object
+	Diff string `json:"diff,omitempty" description:"Difference between live and rendered object"`
+}
+
+// Whether action changes anything in the cluster
+func (a Action) Changes() bool {
+	return a.Action != ActionUpdate || a.Diff != ""
+}
+
+// List of actions for deployment of config
+type Plan struct {
+	// Whether actions are only recorded and not applied
+	DryRun bool `json:"dryRun" description:"Whether actions are only recorded and not applied"`
+
+	// List of actions
+	Actions []Action `json:"actions" description:"List of actions"`
+
+	mutex sync.Mutex
+}
+
+func NewPlan(dryRun bool) *Plan {
+	return &Plan{DryRun: dryRun, Actions: []Action{}}
+}
+
+// Records action
+func (p *Plan) Add(action Action) {
+	p.mutex.Lock()
+	p.Actions = append(p.Actions, action)
+	p.mutex.Unlock()
+}
+
+// Returns human readable difference between live and rendered object,
+// or empty string if they are semantically equal
+func Diff(live, rendered interface{}) string {
+	if api.Semantic.DeepEqual(live, rendered) {
+		return ""
+	}
+
+	return util.ObjectDiff(live, rendered)
+}
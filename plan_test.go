@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	live := api.ServiceSpec{Selector: map[string]string{"role": "web"}}
+	rendered := api.ServiceSpec{Selector: map[string]string{"role": "web"}}
+
+	if diff := Diff(live, rendered); diff != "" {
+		t.Errorf("expected no diff, got %v", diff)
+	}
+
+	rendered.Selector["role"] = "api"
+	if diff := Diff(live, rendered); diff == "" {
+		t.Errorf("expected diff, got none")
+	}
+}
+
+func TestPlanAdd(t *testing.T) {
+	plan := NewPlan(true)
+	plan.Add(Action{Action: ActionDelete, Kind: "Namespace", Name: "test-ns1"})
+
+	if len(plan.Actions) != 1 || plan.Actions[0].Action != ActionDelete {
+		t.Errorf("expected delete action, got %v", plan.Actions)
+	}
+}
+
+func TestProcessPlan(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+	cluster.add("services", "test-prod", &api.Service{
+		ObjectMeta: api.ObjectMeta{Name: "old", Labels: map[string]string{
+			"kubehub/enable": "true", "kubehub/project": "test", "kubehub/name": "old",
+		}},
+		Spec: api.ServiceSpec{Ports: []api.ServicePort{{Port: 80, Protocol: api.ProtocolTCP}}},
+	})
+
+	config := webConfig("v2", nil)
+	config.Templates = append(config.Templates, Template{Name: "db", Content: `
+kind: Service
+apiVersion: v1beta3
+metadata:
+  name: db
+spec:
+  ports:
+  - port: 5432
+`})
+	config.Applications = append(config.Applications, Application{Name: "db", Templates: []string{"db"}})
+	config.ApplicationGroups[0].Applications = []string{"web", "db"}
+	p := newClusterProcess(t, kube, config)
+
+	plan, _, err := p.Plan()
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	actions := map[string]Action{}
+	for _, action := range plan.Actions {
+		actions[action.Action+" "+action.Kind+" "+action.Name] = action
+	}
+	for _, expected := range []string{
+		"update Namespace test-prod",
+		"create Service db",
+		"update Service web",
+		"rolling-update ReplicationController web-v1",
+		"delete Service old",
+	} {
+		if _, ok := actions[expected]; !ok {
+			t.Errorf("expected action %v, got %v", expected, plan.Actions)
+		}
+	}
+	if to := actions["rolling-update ReplicationController web-v1"].To; to != "web-v2" {
+		t.Errorf("expected rolling update to web-v2, got %v", to)
+	}
+
+	if writes := cluster.writeLog(); len(writes) != 0 {
+		t.Errorf("expected plan not to write anything, got %v", writes)
+	}
+}
+
+func TestPlanIgnoresServerFields(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+
+	config := webConfig("v1", nil)
+	config.Templates = append(config.Templates, Template{Name: "job", Content: `
+kind: Pod
+apiVersion: v1beta3
+metadata:
+  name: job
+spec:
+  containers:
+  - name: job
+    image: job
+`})
+	config.Applications = append(config.Applications, Application{Name: "job", Templates: []string{"job"}})
+	config.ApplicationGroups[0].Applications = []string{"web", "job"}
+	p := newClusterProcess(t, kube, config)
+
+	if err := p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	// Pod gets scheduled
+	cluster.get("pods", "test-prod", "job").(*api.Pod).Spec.Host = "node-1"
+
+	plan, _, err := p.Plan()
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	for _, action := range plan.Actions {
+		if action.Changes() {
+			t.Errorf("expected deployed config to have no drift, got %v %v %v", action.Action, action.Name, action.Diff)
+		}
+	}
+}
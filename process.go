@@ -1,24 +1,29 @@
 package main
 
 import (
-	"bytes"
 	"errors"
-	"os"
+	"io/ioutil"
 	"sync"
 	"time"
 	//"fmt"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/fields"
-	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubectl"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/types"
 	log "github.com/Sirupsen/logrus"
-	"github.com/imdario/mergo"
+)
+
+var (
+	ErrNamespaceNotFound = errors.New("Namespace not found")
+	ErrAppNotFound       = errors.New("App not found in namespace")
 )
 
 const (
 	StateProcessing = iota
 	StateReady      = iota
+	StateQueued     = iota
 )
 
 type Entity struct {
@@ -28,10 +33,21 @@ type Entity struct {
 
 type BufferLogger struct {
 	Entries []*log.Entry
+
+	mutex sync.Mutex
 }
 
+// Stores copy of entry, as logrus reuses entries of loggers with fields
 func (l *BufferLogger) Fire(entry *log.Entry) error {
-	l.Entries = append(l.Entries, entry)
+	copied := *entry
+	copied.Data = log.Fields{}
+	for key, value := range entry.Data {
+		copied.Data[key] = value
+	}
+
+	l.mutex.Lock()
+	l.Entries = append(l.Entries, &copied)
+	l.mutex.Unlock()
 	return nil
 }
 
@@ -50,67 +66,472 @@ func NewBufferLoggerHook() *BufferLogger {
 	return &BufferLogger{}
 }
 
+// Returns logger holding entries logged so far, nil if logger is nil
+func (l *BufferLogger) Copy() *BufferLogger {
+	if l == nil {
+		return nil
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return &BufferLogger{Entries: append([]*log.Entry{}, l.Entries...)}
+}
+
 type Process struct {
-	Kube    *client.Client
-	Config  *Config
-	mutex   sync.Mutex
-	err     error
-	logger  *BufferLogger
-	state   int
-	cfgFile string
+	Kube      *client.Client
+	Config    *Config
+	Store     ConfigStore
+	Revisions RevisionStore
+
+	// Whether to wait for every app to become ready before deployment
+	// succeeds, otherwise only dependencies of other apps are waited for
+	WaitForReady bool
+
+	// How long to wait for app to become ready
+	ReadyTimeout time.Duration
+
+	// Number of apps deployed at once per namespace
+	NamespaceWorkers int
+
+	// Number of namespaces deployed at once
+	ParallelNamespaces int
+
+	// Records actions as kubernetes events, disabled if nil
+	Recorder EventRecorder
+
+	// Persists deployments and their logs, disabled if nil
+	Deploys DeployStore
+
+	// Held while config is copied for deployment, so it is not changed
+	// meanwhile, config is copied unlocked if nil
+	ConfigLock sync.Locker
+
+	// Limits number of apps deployed at once across all namespaces
+	workers chan struct{}
+
+	// Blue-green and canary rollouts waiting for promotion
+	rollouts *RolloutGates
+
+	// Streams events of current deployment
+	stream *DeployStream
+
+	mutex  sync.Mutex
+	err    error
+	logger *BufferLogger
+	status *DeployStatus
+	state  int
+
+	// Current deployment, zero id if not recorded
+	current *Deploy
+
+	// Deployment waiting for current one, further requests are coalesced
+	// into it
+	queued *Deploy
+
+	// Config of last committed revision, reconciliations deploy it instead
+	// of config changed since
+	deployed *Config
+
+	// Whether deployments are being run
+	running bool
 }
 
-func NewProcess(Kube *client.Client, Config *Config, cfgFile string) (*Process, error) {
-	log.Infof("Loading config file %v", cfgFile)
+func NewProcess(Kube *client.Client, Config *Config, Store ConfigStore, Revisions RevisionStore) (*Process, error) {
+	log.Info("Loading config")
+
+	if err := Store.Load(Config); err == ErrConfigNotFound {
+		log.Warn("Config not found, starting with empty config")
+	} else if err != nil {
+		return nil, err
+	}
 
-	f, err := os.Open(cfgFile)
+	// Stored config is config of last committed revision
+	deployed, err := Config.Copy()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := Config.Load(f); err != nil {
+	return &Process{
+		Config:             Config,
+		Kube:               Kube,
+		Store:              Store,
+		Revisions:          Revisions,
+		ReadyTimeout:       5 * time.Minute,
+		NamespaceWorkers:   4,
+		ParallelNamespaces: 4,
+		workers:            make(chan struct{}, 8),
+		rollouts:           NewRolloutGates(),
+		stream:             NewDeployStream(),
+		state:              StateReady,
+		mutex:              sync.Mutex{},
+		deployed:           deployed,
+	}, nil
+}
+
+// Sets number of apps deployed at once, in total and per namespace
+func (p *Process) SetConcurrency(total, perNamespace int) {
+	if total < 1 {
+		total = 1
+	}
+
+	p.workers = make(chan struct{}, total)
+	p.NamespaceWorkers = perNamespace
+}
+
+// Queues deployment of config as new revision
+func (p *Process) Commit(author, source string) (*Deploy, error) {
+	log.Info("Queueing new config")
+
+	if err := CheckDependencies(p.Config.Applications); err != nil {
 		return nil, err
 	}
 
-	f.Close()
-	return &Process{Config: Config, Kube: Kube, state: StateReady, mutex: sync.Mutex{}, cfgFile: cfgFile}, nil
+	return p.enqueue(DeployRequest{Author: author, Source: source}), nil
 }
 
-func (p *Process) Commit() error {
-	log.Info("Deploying new config")
+// Restores config from revision and queues its deployment as a new revision
+func (p *Process) Rollback(id int, author string) (*Deploy, error) {
+	log.Infof("Rolling back to revision %v", id)
 
+	rev, err := p.Revisions.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Versions keep increasing, so clients holding restored entities conflict
+	version := p.Config.Version
+	*p.Config = rev.Config
+	p.Config.Version = version
+	p.Config.SetVersions(true)
+	return p.enqueue(DeployRequest{Author: author, Source: SourceRollback, Rollback: id}), nil
+}
+
+// Queues redeployment of config of last committed revision, config
+// changed since is not deployed
+func (p *Process) Reconcile() {
+	log.Info("Queueing reconciliation of config")
+
+	p.enqueue(DeployRequest{Source: SourceReconcile})
+}
+
+// Returns project of config of last committed revision
+func (p *Process) Project() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.deployed.Project
+}
+
+// Returns config of last committed revision, it is not changed
+func (p *Process) deployedConfig() *Config {
 	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-	f, err := os.Create(p.cfgFile)
+	return p.deployed
+}
+
+// Returns copy of config deployment runs on, config changed later is
+// deployed by next deployment
+func (p *Process) configSnapshot() (*Config, error) {
+	if p.ConfigLock != nil {
+		p.ConfigLock.Lock()
+		defer p.ConfigLock.Unlock()
+	}
+
+	return p.Config.Copy()
+}
+
+// Returns process deploying config, sharing cluster, workers and rollouts
+// with p
+func (p *Process) withConfig(config *Config) *Process {
+	return &Process{
+		Kube:               p.Kube,
+		Config:             config,
+		Store:              p.Store,
+		Revisions:          p.Revisions,
+		WaitForReady:       p.WaitForReady,
+		ReadyTimeout:       p.ReadyTimeout,
+		NamespaceWorkers:   p.NamespaceWorkers,
+		ParallelNamespaces: p.ParallelNamespaces,
+		Recorder:           p.Recorder,
+		Deploys:            p.Deploys,
+		workers:            p.workers,
+		rollouts:           p.rollouts,
+		stream:             p.stream,
+		state:              StateProcessing,
+	}
+}
+
+// Writes config and records it as revision of request deployed by deploy
+func (p *Process) commit(config *Config, request DeployRequest, deployId int) (*Revision, error) {
+	if err := CheckDependencies(config.Applications); err != nil {
+		return nil, err
+	}
+
+	if err := p.Store.Save(config); err != nil {
+		return nil, err
+	}
+
+	lastId, err := p.Revisions.LastId()
 	if err != nil {
-		p.mutex.Unlock()
-		return err
+		return nil, err
 	}
 
-	p.Config.Commit(f)
-	f.Close()
+	rev := &Revision{Id: lastId + 1, Author: request.Author, Source: request.Source, Rollback: request.Rollback, Deploy: deployId}
+
+	revConfig, err := config.Copy()
+	if err != nil {
+		return nil, err
+	}
 
-	go func() {
-		p.state = StateProcessing
-		logger := log.New()
-		logger.Level = log.DebugLevel
-		p.logger = NewBufferLoggerHook()
-		logger.Hooks.Add(p.logger)
+	rev.Config = *revConfig
+	rev.Created = time.Now()
+	rev.State = StateProcessing
+	rev.Logs = []LogEntry{}
+	if err := p.Revisions.Save(rev); err != nil {
+		return nil, err
+	}
 
-		p.err = p.CreateNamespaces(logger)
-		p.mutex.Unlock()
-		p.state = StateReady
-	}()
+	p.mutex.Lock()
+	p.deployed = config
+	p.mutex.Unlock()
 
-	return nil
+	return rev, nil
 }
 
+// Deploys config and stores result in revision if set, status and logs
+// of deployment are published under process mutex
+func (p *Process) deploy(config *Config, rev *Revision) {
+	status := NewDeployStatus(config.Namespaces)
+	buffer := NewBufferLoggerHook()
+
+	p.mutex.Lock()
+	p.status = status
+	p.logger = buffer
+	id := p.current.Id
+	p.mutex.Unlock()
+
+	logger := log.New()
+	logger.Level = log.DebugLevel
+	logger.Hooks.Add(buffer)
+	logger.Hooks.Add(&StreamLogger{Stream: p.stream, Id: id})
+	if id != 0 {
+		logger.Hooks.Add(&DeployLogger{Store: p.Deploys, Id: id})
+	}
+
+	started := time.Now()
+	plan := NewPlan(false)
+	err := p.withConfig(config).CreateNamespaces(logger, plan, status)
+	recordDeploy(started, err, plan, status)
+
+	p.mutex.Lock()
+	p.err = err
+	p.mutex.Unlock()
+	p.finishDeploy(err)
+
+	if rev != nil {
+		rev.SetResult(StateReady, buffer, err)
+		if err := p.Revisions.Save(rev); err != nil {
+			log.Errorf("Cannot save revision %v %v", rev.Id, err)
+		}
+	}
+
+	p.mutex.Lock()
+	p.state = StateReady
+	p.mutex.Unlock()
+}
+
+// Records result of current deployment and ends its stream
+func (p *Process) finishDeploy(err error) {
+	p.mutex.Lock()
+	p.current.Finished = time.Now()
+	p.current.State = StateReady
+	if err != nil {
+		p.current.Error = err.Error()
+	}
+	finished := *p.current
+	p.mutex.Unlock()
+
+	if finished.Id != 0 {
+		if saveErr := p.Deploys.Save(&finished); saveErr != nil {
+			log.Errorf("Cannot save deploy %v %v", finished.Id, saveErr)
+		}
+	}
+
+	p.stream.Finish(finished)
+}
+
+// Returns state, copy of logs and error of last deployment
 func (p *Process) Status() (int, *BufferLogger, error) {
-	return p.state, p.logger, p.err
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.state, p.logger.Copy(), p.err
 }
 
-// Create namespaces
-func (p *Process) CreateNamespaces(logger *log.Logger) error {
+// Returns number of last deployment, zero if deployments are not recorded
+func (p *Process) DeployId() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.current == nil {
+		return 0
+	}
+
+	return p.current.Id
+}
+
+// Returns events of deployment published so far and channel of further
+// events, events of finished deployments are read from stored logs
+func (p *Process) DeployEvents(id int) ([]DeployEvent, <-chan DeployEvent, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if past, events, ok := p.stream.Subscribe(id); ok {
+		return past, events, nil
+	}
+
+	// Queued deployment is streamed once it starts
+	if p.queued != nil && p.queued.Id == id {
+		queued := *p.queued
+		return []DeployEvent{{Type: EventState, Deploy: &queued}}, p.stream.SubscribeNext(id), nil
+	}
+
+	if p.Deploys == nil {
+		return nil, nil, ErrDeployNotFound
+	}
+
+	past, err := StoredEvents(p.Deploys, id)
+	return past, nil, err
+}
+
+// Stops streaming events of deployment to subscriber
+func (p *Process) StopDeployEvents(events <-chan DeployEvent) {
+	p.stream.Unsubscribe(events)
+}
+
+// Returns status of namespaces of last deployment
+func (p *Process) NamespaceStatus() []NamespaceStatus {
+	p.mutex.Lock()
+	status := p.status
+	p.mutex.Unlock()
+
+	return status.Namespaces()
+}
+
+// Computes actions needed to deploy current config, without changing anything,
+// config is copied under config lock
+func (p *Process) Plan() (*Plan, *BufferLogger, error) {
+	log.Info("Planning new config")
+
+	logger := log.New()
+	logger.Level = log.DebugLevel
+	buffer := NewBufferLoggerHook()
+	logger.Hooks.Add(buffer)
+
+	// Config is planned as copied, so api can change it meanwhile
+	config, err := p.configSnapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := NewPlan(true)
+	err = p.withConfig(config).CreateNamespaces(logger, plan, NewDeployStatus(config.Namespaces))
+
+	return plan, buffer, err
+}
+
+// Computes actions reconciliation would perform, that is drift of cluster
+// from config of last committed revision
+func (p *Process) PlanReconcile() (*Plan, error) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+
+	config := p.deployedConfig()
+	plan := NewPlan(true)
+	err := p.withConfig(config).CreateNamespaces(logger, plan, NewDeployStatus(config.Namespaces))
+
+	return plan, err
+}
+
+// Finds app of namespace with its group
+func (p *Process) findApp(nsName, appName string) (Namespace, ApplicationGroup, Application, error) {
+	ns, ok := IndexList(func(ns interface{}) string {
+		return ns.(Namespace).Name
+	}, p.Config.Namespaces)[nsName].(Namespace)
+	if !ok {
+		return Namespace{}, ApplicationGroup{}, Application{}, ErrNamespaceNotFound
+	}
+
+	group, ok := IndexList(func(group interface{}) string {
+		return group.(ApplicationGroup).Name
+	}, p.Config.ApplicationGroups)[ns.ApplicationGroup].(ApplicationGroup)
+	if !ok {
+		return ns, ApplicationGroup{}, Application{}, ErrAppNotFound
+	}
+
+	app, ok := IndexList(func(app interface{}) string {
+		return app.(Application).Name
+	}, p.Config.Applications)[appName].(Application)
+	inGroup := Filter(func(name interface{}) bool {
+		return name.(string) == appName
+	}, group.Applications)
+	if !ok || len(inGroup) == 0 {
+		return ns, group, Application{}, ErrAppNotFound
+	}
+
+	return ns, group, app, nil
+}
+
+// Renders objects of app as they would be deployed to namespace, in order
+// of their creation
+func (p *Process) Render(nsName, appName string) ([]runtime.Object, error) {
+	ns, group, app, err := p.findApp(nsName, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	objs, err := p.RenderApp(ns, group, app, logger.WithFields(log.Fields{"namespace": ns.Name, "app": app.Name}))
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := []runtime.Object{}
+	for _, kind := range ManagedKinds {
+		ordered = append(ordered, objs[kind.Name]...)
+	}
+
+	return ordered, nil
+}
+
+// Returns tags app is rendered with in namespace
+func (p *Process) AppTags(nsName, appName string) (Tags, error) {
+	ns, group, app, err := p.findApp(nsName, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	return EffectiveTags(ns, group, app), nil
+}
+
+// Deep merges tags of namespace, group, app and overrides of app in namespace,
+// in order of precedence
+func EffectiveTags(ns Namespace, group ApplicationGroup, app Application) Tags {
+	tags := Tags{}
+	tags.Merge(ns.Tags)
+	tags.Merge(group.Tags)
+	tags.Merge(app.Tags)
+	tags.Merge(ns.Overrides[app.Name])
+
+	return tags
+}
+
+// Create namespaces, all actions are recorded in plan and only applied
+// if plan is not a dry run
+func (p *Process) CreateNamespaces(logger *log.Logger, plan *Plan, status *DeployStatus) error {
 	labelSelector, err := labels.Parse("kubehub/enable=true,kubehub/project=" + p.Config.Project)
 	if err != nil {
 		logger.Errorf("Cannot create label %v", err)
@@ -133,9 +554,8 @@ func (p *Process) CreateNamespaces(logger *log.Logger) error {
 		kubeNs.Items,
 	)
 
-	for _, ns := range p.Config.Namespaces {
+	createNamespace := func(ns Namespace, nsLogger *log.Entry) error {
 		name := p.Config.Project + "-" + ns.Name
-		nsLogger := logger.WithFields(log.Fields{"namespace": ns.Name})
 
 		nsLogger.Info("Processing namespace")
 
@@ -153,30 +573,76 @@ func (p *Process) CreateNamespaces(logger *log.Logger) error {
 			nsLogger.Info("Updating namespace")
 
 			val.(*Entity).Processed = true
-			currentNs := setNs(val.(*Entity).Value.(api.Namespace))
-			_, err := p.Kube.Namespaces().Update(&currentNs)
-			if err != nil {
-				nsLogger.Errorf("Cannot update namespace %v", err)
-				continue
+			liveNs := val.(*Entity).Value.(api.Namespace)
+			currentNs := setNs(liveNs)
+			action := Action{
+				Action: ActionUpdate, Kind: "Namespace", Name: name,
+				Diff: Diff(liveNs.ObjectMeta.Labels, currentNs.ObjectMeta.Labels),
 			}
+			plan.Add(action)
 
-			if p.CreateApps(ns, logger) != nil {
-				nsLogger.Errorf("Cannot create apps")
+			if !plan.DryRun {
+				_, err := p.Kube.Namespaces().Update(&currentNs)
+				if err != nil {
+					nsLogger.Errorf("Cannot update namespace %v", err)
+					return err
+				}
+				p.recordEvent(action, liveNs.UID, nil)
 			}
 		} else {
 			nsLogger.Info("Creating namespace")
 
-			_, err := p.Kube.Namespaces().Create(&namespace)
-			if err != nil {
-				nsLogger.Errorf("Cannot create namespace %v", err)
-				continue
+			action := Action{Action: ActionCreate, Kind: "Namespace", Name: name}
+			plan.Add(action)
+			if !plan.DryRun {
+				created, err := p.Kube.Namespaces().Create(&namespace)
+				if err != nil {
+					nsLogger.Errorf("Cannot create namespace %v", err)
+					return err
+				}
+				p.recordEvent(action, created.UID, nil)
 			}
+		}
 
-			if p.CreateApps(ns, logger) != nil {
-				nsLogger.Errorf("Cannot create apps")
-			}
+		if err := p.CreateApps(ns, logger, plan, status); err != nil {
+			nsLogger.Errorf("Cannot create apps")
+			return err
 		}
+
+		return nil
+	}
+
+	// Namespaces are independent, so they are deployed concurrently by a
+	// pool of workers
+	queue := make(chan Namespace, len(p.Config.Namespaces))
+	for _, ns := range p.Config.Namespaces {
+		queue <- ns
+	}
+	close(queue)
+
+	workers := p.ParallelNamespaces
+	if workers < 1 {
+		workers = 1
+	}
+
+	deployErr := NewDeployError()
+	wait := sync.WaitGroup{}
+	wait.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wait.Done()
+
+			for ns := range queue {
+				status.Start(ns.Name)
+				err := createNamespace(ns, logger.WithFields(log.Fields{"namespace": ns.Name}))
+				if err != nil {
+					deployErr.Add(ns.Name, "", err)
+				}
+				status.Finish(ns.Name, err)
+			}
+		}()
 	}
+	wait.Wait()
 
 	notProcessed := Filter(func(el interface{}) bool {
 		return !el.(*Entity).Processed
@@ -184,19 +650,160 @@ func (p *Process) CreateNamespaces(logger *log.Logger) error {
 	for _, ns := range notProcessed {
 		ns := ns.(*Entity).Value.(api.Namespace)
 		logger.WithFields(log.Fields{"namespace": ns.Name}).Info("Deleting namespace")
+		plan.Add(Action{Action: ActionDelete, Kind: "Namespace", Name: ns.Name})
+		if plan.DryRun {
+			continue
+		}
+
 		// For some reason have to call delete twice
 		err := p.Kube.Namespaces().Delete(ns.Name)
 		err = p.Kube.Namespaces().Delete(ns.Name)
 		if err != nil {
 			logger.WithFields(log.Fields{"namespace": ns.Name}).Errorf("Cannot delete namespace %v", err)
+			deployErr.Add(ns.Name, "", err)
 		}
 	}
 
-	return nil
+	return deployErr.Err()
 }
 
-// Creates apps for namespace
-func (p *Process) CreateApps(ns Namespace, logger *log.Logger) error {
+// Returns key under which object is indexed
+func ObjectKey(kind string, meta *api.ObjectMeta) string {
+	return kind + "/" + meta.Name
+}
+
+// Returns live replication controller of app that rendered controller is
+// rolled out from. Controller named as rendered one is left by interrupted
+// rollout, it is kept as rollout target, so rollout resumes from controller
+// with most replicas of the others. Remaining controllers of app are left
+// unprocessed, so they are garbage collected.
+func liveController(kubeIndex map[string]interface{}, appName, rendered string) *Entity {
+	var target, live *Entity
+	for _, value := range kubeIndex {
+		entity := value.(*Entity)
+		rc, ok := entity.Value.(*api.ReplicationController)
+		if !ok || rc.Labels["kubehub/name"] != appName {
+			continue
+		}
+
+		if rc.Name == rendered {
+			target = entity
+			continue
+		}
+
+		if live == nil {
+			live = entity
+			continue
+		}
+		liveRc := live.Value.(*api.ReplicationController)
+		if rc.Spec.Replicas > liveRc.Spec.Replicas || (rc.Spec.Replicas == liveRc.Spec.Replicas && rc.Name < liveRc.Name) {
+			live = entity
+		}
+	}
+
+	if live == nil {
+		return target
+	}
+	if target != nil {
+		target.Processed = true
+	}
+
+	return live
+}
+
+// Whether object was created by cluster for object kubehub manages, like
+// pods of replication controllers and endpoints of services, which inherit
+// kubehub labels but are not rendered by kubehub
+func InheritedObject(kind string, meta *api.ObjectMeta) bool {
+	_, rendered := meta.Annotations["kubehub/rendered"]
+	return !rendered && (kind == "Pod" || kind == "Endpoints")
+}
+
+// Renders all objects of app in namespace, objects are labeled and indexed
+// by kind
+func (p *Process) RenderApp(ns Namespace, group ApplicationGroup, app Application, appLogger *log.Entry) (map[string][]runtime.Object, error) {
+	templates := IndexList(func(tpl interface{}) string {
+		return tpl.(Template).Name
+	}, p.Config.Templates)
+
+	tags := EffectiveTags(ns, group, app)
+
+	// Labels are copied by endpoints of services, so objects rendered by
+	// kubehub are marked by annotation
+	setMeta := func(meta *api.ObjectMeta) {
+		meta.Labels = map[string]string{
+			"kubehub/enable":  "true",
+			"kubehub/project": p.Config.Project,
+			"kubehub/name":    app.Name,
+		}
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations["kubehub/rendered"] = "true"
+	}
+
+	objs := make(map[string][]runtime.Object)
+	rcs := 0
+	for _, tplName := range app.TemplateNames() {
+		tplLogger := appLogger.WithFields(log.Fields{"template": tplName})
+
+		tplLogger.Info("Processing template")
+
+		template, ok := templates[tplName].(Template)
+		if !ok {
+			err := errors.New("Template not found")
+			tplLogger.Error(err)
+			return nil, err
+		}
+
+		tplObjs, err := template.Generate(p.Kube, tags, p.Config.Templates)
+		if err != nil {
+			tplLogger.Errorf("Cannot generate template %v", err)
+			return nil, err
+		}
+
+		for _, obj := range tplObjs {
+			kind, err := ObjectKind(obj)
+			if err != nil {
+				tplLogger.Errorf("Cannot get template kind %v", err)
+				return nil, err
+			}
+
+			if _, err := FindKind(kind); err != nil {
+				tplLogger.Error(err)
+				return nil, err
+			}
+
+			meta, err := api.ObjectMetaFor(obj)
+			if err != nil {
+				tplLogger.Errorf("Cannot get template metadata %v", err)
+				return nil, err
+			}
+			setMeta(meta)
+
+			// Service referenced by application service field is named after application
+			if kind == "Service" && tplName == app.Service && len(tplObjs) == 1 {
+				meta.Name = app.Name
+			}
+
+			if kind == "ReplicationController" {
+				if rcs++; rcs > 1 {
+					err := errors.New("Only one replication controller per application is supported")
+					tplLogger.Error(err)
+					return nil, err
+				}
+			}
+
+			objs[kind] = append(objs[kind], obj)
+		}
+	}
+
+	return objs, nil
+}
+
+// Creates apps for namespace, all actions are recorded in plan and only
+// applied if plan is not a dry run
+func (p *Process) CreateApps(ns Namespace, logger *log.Logger, plan *Plan, status *DeployStatus) error {
 	nsName := p.Config.Project + "-" + ns.Name
 	nsLogger := logger.WithFields(log.Fields{"namespace": ns.Name})
 
@@ -208,243 +815,425 @@ func (p *Process) CreateApps(ns Namespace, logger *log.Logger) error {
 		return app.(Application).Name
 	}, p.Config.Applications)
 
-	templates := IndexList(func(tpl interface{}) string {
-		return tpl.(Template).Name
-	}, p.Config.Templates)
-
 	labelSelector, err := labels.Parse("kubehub/enable=true,kubehub/project=" + p.Config.Project)
 	if err != nil {
 		nsLogger.Errorf("Cannot create label %v", err)
 		return err
 	}
 
-	kubeSc, err := p.Kube.Services(nsName).List(labelSelector)
-	if err != nil {
-		nsLogger.Errorf("Cannot list services %v", err)
-		return err
-	}
+	// Index all managed objects by kind and name
+	kubeIndex := make(map[string]interface{})
+	for _, kind := range ManagedKinds {
+		objs, err := kind.List(p.Kube, nsName, labelSelector)
+		if err != nil {
+			nsLogger.Errorf("Cannot list %v %v", kind.Resource, err)
+			return err
+		}
 
-	// Index by service label kubehub/name
-	kubeScIndex := IndexMapList(
-		func(ns interface{}) string {
-			return ns.(api.Service).Name
-		},
-		func(ns interface{}) interface{} {
-			return &Entity{ns, false}
-		},
-		kubeSc.Items,
-	)
+		for _, obj := range objs {
+			meta, err := api.ObjectMetaFor(obj)
+			if err != nil {
+				nsLogger.Errorf("Cannot get %v metadata %v", kind.Resource, err)
+				return err
+			}
 
-	kubeRc, err := p.Kube.ReplicationControllers(nsName).List(labelSelector)
-	if err != nil {
-		nsLogger.Errorf("Cannot list replication controllers %v", err)
-		return err
+			// Inherited objects are not garbage collected, they are only
+			// updated if they are rendered
+			kubeIndex[ObjectKey(kind.Name, meta)] = &Entity{obj, InheritedObject(kind.Name, meta)}
+		}
 	}
 
-	// Index by replication controller label kubehub/name
-	kubeRcIndex := IndexMapList(
-		func(ns interface{}) string {
-			krc := ns.(api.ReplicationController)
-			if name, ok := krc.ObjectMeta.Labels["kubehub/name"]; ok {
-				return name
-			} else {
-				return krc.Name
-			}
-		},
-		func(ns interface{}) interface{} {
-			return &Entity{ns, false}
-		},
-		kubeRc.Items,
-	)
-
 	createApp := func(group ApplicationGroup, app Application) error {
 		appLogger := nsLogger.WithFields(log.Fields{"app": app.Name})
 
-		// Merge tags from namespace, group and app
-		tags := make(map[string]string)
-		mergo.Merge(&tags, ns.Tags)
-		mergo.MergeWithOverwrite(&tags, group.Tags)
-		mergo.MergeWithOverwrite(&tags, app.Tags)
+		// Generate all objects before applying any of them
+		objs, err := p.RenderApp(ns, group, app, appLogger)
+		if err != nil {
+			return err
+		}
 
-		setMeta := func(meta *api.ObjectMeta) {
-			meta.Labels = map[string]string{
-				"kubehub/enable":  "true",
-				"kubehub/project": p.Config.Project,
-				"kubehub/name":    app.Name,
-			}
+		rendered := ""
+		for _, obj := range objs["ReplicationController"] {
+			rendered = obj.(*api.ReplicationController).Name
+		}
+		rcEntity := liveController(kubeIndex, app.Name, rendered)
+
+		// Services switched by blue-green rollout keep selecting pods of live
+		// replication controller of app
+		var liveRc *api.ReplicationController
+		if rcEntity != nil {
+			liveRc = rcEntity.Value.(*api.ReplicationController)
 		}
 
-		// Process service
-		if app.Service != "" {
-			scLogger := appLogger.WithFields(log.Fields{"template": app.Service})
+		// Apply objects in order of creation of their kinds
+		for _, kind := range ManagedKinds {
+			for _, obj := range objs[kind.Name] {
+				meta, _ := api.ObjectMetaFor(obj)
+				objLogger := appLogger.WithFields(log.Fields{"kind": kind.Name, "name": meta.Name})
+				entity, _ := kubeIndex[ObjectKey(kind.Name, meta)].(*Entity)
+
+				var err error
+				switch kind.Name {
+				case "Service":
+					err = p.applyService(nsName, app, obj.(*api.Service), entity, liveRc, plan, objLogger)
+				case "ReplicationController":
+					err = p.applyReplicationController(nsName, app, obj.(*api.ReplicationController), rcEntity, plan, objLogger)
+				default:
+					err = p.applyObject(nsName, app, kind, obj, entity, plan, objLogger)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
 
-			scLogger.Info("Processing service")
+		return nil
+	}
 
-			template, ok := templates[app.Service].(Template)
+	deployErr := NewDeployError()
+	if group, ok := appGroups[ns.ApplicationGroup].(ApplicationGroup); ok {
+		groupApps := []Application{}
+		for _, name := range group.Applications {
+			app, ok := apps[name].(Application)
 			if !ok {
-				err := errors.New("Template for service not found")
-				scLogger.Error(err)
+				err := errors.New("App not found " + name)
+				nsLogger.Error(err)
 				return err
 			}
 
-			sc, _, err := template.Generate(p.Kube, tags)
-			if err != nil {
-				scLogger.Errorf("Cannot generate service template %v", err)
-				return err
+			groupApps = append(groupApps, app)
+		}
+
+		order, err := SortApps(groupApps, group.Applications)
+		if err != nil {
+			nsLogger.Error(err)
+			return err
+		}
+
+		dependents := map[string]bool{}
+		for _, app := range groupApps {
+			for _, dep := range app.DependsOn {
+				dependents[dep] = true
 			}
-			tplSc := sc.(*api.Service)
-			setMeta(&tplSc.ObjectMeta)
-			tplSc.Name = app.Name
+		}
+
+		// Apps are queued in dependency order, so dependencies of an app are
+		// always already taken by some worker
+		queue := make(chan Application, len(order))
+		done := map[string]chan struct{}{}
+		for _, name := range order {
+			queue <- apps[name].(Application)
+			done[name] = make(chan struct{})
+		}
+		close(queue)
 
-			if entity, ok := kubeScIndex[app.Name].(*Entity); ok {
-				sc := entity.Value.(api.Service)
-				scLogger.Info("Updating service")
+		failed := map[string]bool{}
+		mutex := sync.Mutex{}
 
-				if tplSc.Spec.PortalIP == "" {
-					tplSc.Spec.PortalIP = sc.Spec.PortalIP
-					tplSc.ResourceVersion = sc.ResourceVersion
+		deployApp := func(app Application, appLogger *log.Entry) (string, error) {
+			for _, dep := range app.DependsOn {
+				depDone, ok := done[dep]
+				if !ok {
+					continue
 				}
 
-				_, err := p.Kube.Services(sc.Namespace).Update(tplSc)
-				if err != nil {
-					scLogger.Errorf("Cannot update service %v", err)
-					return err
+				<-depDone
+				mutex.Lock()
+				depFailed := failed[dep]
+				mutex.Unlock()
+				if depFailed {
+					err := errors.New("Dependency " + dep + " failed")
+					appLogger.Error(err)
+					return "", err
 				}
+			}
+
+			// Limit number of apps deployed at once across all namespaces
+			p.workers <- struct{}{}
+			defer func() { <-p.workers }()
+
+			if err := createApp(group, app); err != nil {
+				return "", err
+			}
+
+			if (dependents[app.Name] || p.WaitForReady) && !plan.DryRun {
+				appLogger.Info("Waiting for app to become ready")
+				if err := p.WaitReady(nsName, app.Name, p.ReadyTimeout); err != nil {
+					appLogger.Errorf("App did not become ready %v", err)
+					return HealthUnready, errors.New("App did not become ready: " + err.Error())
+				}
+
+				return HealthReady, nil
+			}
+
+			return "", nil
+		}
+
+		workers := p.NamespaceWorkers
+		if workers < 1 {
+			workers = 1
+		}
+
+		wait := sync.WaitGroup{}
+		wait.Add(workers)
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wait.Done()
+
+				for app := range queue {
+					started := time.Now()
+					health, err := deployApp(app, nsLogger.WithFields(log.Fields{"app": app.Name}))
+					if err != nil {
+						mutex.Lock()
+						failed[app.Name] = true
+						mutex.Unlock()
+						deployErr.Add(ns.Name, app.Name, err)
+					}
+					status.AddApp(ns.Name, app.Name, started, health, err)
+					close(done[app.Name])
+				}
+			}()
+		}
+
+		wait.Wait()
 
+		// Objects of failed apps and apps skipped because of failed
+		// dependencies are left as they are instead of garbage collected
+		for _, value := range kubeIndex {
+			entity := value.(*Entity)
+			meta, _ := api.ObjectMetaFor(entity.Value.(runtime.Object))
+			if failed[meta.Labels["kubehub/name"]] {
 				entity.Processed = true
-			} else {
-				scLogger.Info("Creating service")
-				_, err := p.Kube.Services(nsName).Create(tplSc)
-				if err != nil {
-					scLogger.Errorf("Cannot create service %v", err)
-					return err
+			}
+		}
+	} else {
+		err := errors.New("Application group not found " + ns.ApplicationGroup)
+		nsLogger.Error(err)
+		deployErr.Add(ns.Name, "", err)
+	}
+
+	// Garbage collect objects in reverse order of creation
+	for i := len(ManagedKinds) - 1; i >= 0; i-- {
+		kind := ManagedKinds[i]
+
+		gcObjects := Filter(func(el interface{}) bool {
+			_, objKind, _ := api.Scheme.ObjectVersionAndKind(el.(*Entity).Value.(runtime.Object))
+			return !el.(*Entity).Processed && objKind == kind.Name
+		}, Values(kubeIndex))
+		for _, obj := range gcObjects {
+			obj := obj.(*Entity).Value.(runtime.Object)
+			meta, _ := api.ObjectMetaFor(obj)
+			objLogger := nsLogger.WithFields(log.Fields{"kind": kind.Name, "name": meta.Name})
+
+			objLogger.Info("Deleting object")
+			action := Action{Action: ActionDelete, Kind: kind.Name, Namespace: nsName, Name: meta.Name, App: meta.Labels["kubehub/name"]}
+			plan.Add(action)
+			if plan.DryRun {
+				continue
+			}
+
+			// Replication controllers have to be resized to zero before deletion
+			if rc, ok := obj.(*api.ReplicationController); ok {
+				rc.Spec.Replicas = 0
+				if _, err := p.Kube.ReplicationControllers(nsName).Update(rc); err != nil {
+					objLogger.Errorf("Cannot delete rc, cannot set replicas to 0 %v", err)
+					deployErr.Add(ns.Name, meta.Labels["kubehub/name"], err)
 				}
 			}
+
+			if err := kind.Delete(p.Kube, nsName, meta.Name); err != nil {
+				objLogger.Errorf("Cannot delete object %v", err)
+				deployErr.Add(ns.Name, meta.Labels["kubehub/name"], err)
+				continue
+			}
+			p.recordEvent(action, meta.UID, nil)
 		}
+	}
+
+	return deployErr.Err()
+}
 
-		// Process replication controller
-		if app.ReplicationController != "" {
-			rcLogger := appLogger.WithFields(log.Fields{"template": app.ReplicationController})
+// Creates or updates service, selector of service switched by blue-green
+// rollout to pods of live replication controller is kept
+func (p *Process) applyService(nsName string, app Application, tplSc *api.Service, entity *Entity, liveRc *api.ReplicationController, plan *Plan, logger *log.Entry) error {
+	if entity != nil {
+		sc := entity.Value.(*api.Service)
+		logger.Info("Updating service")
 
-			rcLogger.Info("Processing ReplicationController")
+		if tplSc.Spec.PortalIP == "" {
+			tplSc.Spec.PortalIP = sc.Spec.PortalIP
+			tplSc.ResourceVersion = sc.ResourceVersion
+		}
 
-			template, ok := templates[app.ReplicationController].(Template)
-			if !ok {
-				err := errors.New("Template for rc not found")
-				rcLogger.Error(err)
+		if liveRc != nil && p.RolloutStrategy(app).Type == RolloutBlueGreen &&
+			SwitchedSelector(sc.Spec.Selector, tplSc.Spec.Selector, liveRc.Spec.Selector) {
+			tplSc.Spec.Selector = sc.Spec.Selector
+		}
+
+		action := Action{
+			Action: ActionUpdate, Kind: "Service", Namespace: nsName, Name: tplSc.Name, App: app.Name,
+			Diff: Diff(sc.Spec, tplSc.Spec),
+		}
+		plan.Add(action)
+		if !plan.DryRun {
+			_, err := p.Kube.Services(nsName).Update(tplSc)
+			if err != nil {
+				logger.Errorf("Cannot update service %v", err)
 				return err
 			}
+			p.recordEvent(action, sc.UID, nil)
+		}
 
-			rc, _, err := template.Generate(p.Kube, tags)
+		entity.Processed = true
+	} else {
+		logger.Info("Creating service")
+		action := Action{Action: ActionCreate, Kind: "Service", Namespace: nsName, Name: tplSc.Name, App: app.Name}
+		plan.Add(action)
+		if !plan.DryRun {
+			created, err := p.Kube.Services(nsName).Create(tplSc)
 			if err != nil {
-				rcLogger.Error("Cannot generate rc template %v", err)
+				logger.Errorf("Cannot create service %v", err)
 				return err
 			}
-			tplRc := rc.(*api.ReplicationController)
-			setMeta(&tplRc.ObjectMeta)
-			rcLogger = rcLogger.WithFields(log.Fields{"rc": tplRc.Name})
+			p.recordEvent(action, created.UID, nil)
+		}
+	}
 
-			if entity, ok := kubeRcIndex[app.Name].(*Entity); ok {
-				rc := entity.Value.(api.ReplicationController)
+	return nil
+}
 
-				rcLogger.Info("Updating rc")
+// Creates, updates or rolling updates replication controller
+func (p *Process) applyReplicationController(nsName string, app Application, tplRc *api.ReplicationController, entity *Entity, plan *Plan, logger *log.Entry) error {
+	if entity != nil {
+		rc := entity.Value.(*api.ReplicationController)
 
-				if tplRc.Name != rc.Name {
-					rcLogger.WithFields(log.Fields{"to": tplRc.Name}).Info("Rollupdating")
+		logger.Info("Updating rc")
 
-					buf := bytes.NewBuffer(nil)
-					updater := kubectl.NewRollingUpdater(nsName, p.Kube)
-					err := updater.Update(buf, &rc, tplRc, 1*time.Second, 1*time.Second, 10*time.Second)
-					if err != nil {
-						rcLogger.Error("Problem with rolling update %v", err)
-						return err
-					}
+		if tplRc.Name != rc.Name {
+			strategy := p.RolloutStrategy(app)
+			logger.WithFields(log.Fields{"to": tplRc.Name, "type": strategy.Type}).Info("Rollupdating")
+
+			action := ActionRollingUpdate
+			switch strategy.Type {
+			case RolloutBlueGreen:
+				action = ActionBlueGreen
+			case RolloutCanary:
+				action = ActionCanary
+			}
+
+			rollout := Action{
+				Action: action, Kind: "ReplicationController", Namespace: nsName,
+				Name: rc.Name, App: app.Name, To: tplRc.Name, Diff: Diff(rc.Spec, tplRc.Spec),
+			}
+			plan.Add(rollout)
+			if !plan.DryRun {
+				err := p.Rollout(nsName, app.Name, rc, tplRc, strategy, logger)
+
+				// New replication controller is removed on abort
+				var uid types.UID
+				if current, getErr := p.Kube.ReplicationControllers(nsName).Get(tplRc.Name); getErr == nil {
+					uid = current.UID
 				} else {
-					rc.Spec.Replicas = tplRc.Spec.Replicas
-					_, err := p.Kube.ReplicationControllers(rc.Namespace).Update(&rc)
-					if err != nil {
-						rcLogger.Error("Cannot update replication controller  %v", err)
-						return err
-					}
+					rollout.To = ""
+					uid = rc.UID
 				}
+				p.recordEvent(rollout, uid, err)
 
+				// Replication controller left by failed rollout, either
+				// rolled back, aborted or partially rolled out, is not garbage
+				// collected
 				entity.Processed = true
-			} else {
-				rcLogger.Info("Creating replication controller")
-				_, err := p.Kube.ReplicationControllers(nsName).Create(tplRc)
 				if err != nil {
-					rcLogger.Errorf("Cannot create replication controller %v", err)
+					logger.Errorf("Problem with rolling update %v", err)
 					return err
 				}
 			}
+		} else {
+			action := Action{
+				Action: ActionUpdate, Kind: "ReplicationController", Namespace: nsName,
+				Name: rc.Name, App: app.Name, Diff: Diff(rc.Spec.Replicas, tplRc.Spec.Replicas),
+			}
+			plan.Add(action)
+			if !plan.DryRun {
+				rc.Spec.Replicas = tplRc.Spec.Replicas
+				_, err := p.Kube.ReplicationControllers(nsName).Update(rc)
+				if err != nil {
+					logger.Errorf("Cannot update replication controller  %v", err)
+					return err
+				}
+				p.recordEvent(action, rc.UID, nil)
+			}
 		}
 
-		return nil
-	}
-
-	var appErr error
-	if group, ok := appGroups[ns.ApplicationGroup].(ApplicationGroup); ok {
-		wait := sync.WaitGroup{}
-		wait.Add(len(group.Applications))
-
-		for _, app := range group.Applications {
-			if app, ok := apps[app].(Application); ok {
-				go func() {
-					err := createApp(group, app)
-					if err != nil {
-						appErr = err
-					}
-					wait.Done()
-				}()
-			} else {
-				err := errors.New("App not found " + app.Name)
-				nsLogger.Error(err)
+		entity.Processed = true
+	} else {
+		logger.Info("Creating replication controller")
+		action := Action{Action: ActionCreate, Kind: "ReplicationController", Namespace: nsName, Name: tplRc.Name, App: app.Name}
+		plan.Add(action)
+		if !plan.DryRun {
+			created, err := p.Kube.ReplicationControllers(nsName).Create(tplRc)
+			if err != nil {
+				logger.Errorf("Cannot create replication controller %v", err)
 				return err
 			}
+			p.recordEvent(action, created.UID, nil)
 		}
-
-		wait.Wait()
-	} else {
-		nsLogger.WithFields(log.Fields{"group": group.Name}).Error("Application group not found")
 	}
 
-	// Garbage collect services
-	gcServices := Filter(func(el interface{}) bool {
-		return !el.(*Entity).Processed
-	}, Values(kubeScIndex))
-	for _, sc := range gcServices {
-		sc := sc.(*Entity).Value.(api.Service)
+	return nil
+}
 
-		nsLogger.WithFields(log.Fields{"service": sc.Name}).Info("Deleting service")
-		err := p.Kube.Services(sc.Namespace).Delete(sc.Name)
-		if err != nil {
-			nsLogger.WithFields(log.Fields{"service": sc.Name}).Errorf("Cannot delete service %v", err)
-			appErr = err
-		}
+// Creates or updates object of any other managed kind
+func (p *Process) applyObject(nsName string, app Application, kind Kind, obj runtime.Object, entity *Entity, plan *Plan, logger *log.Entry) error {
+	meta, err := api.ObjectMetaFor(obj)
+	if err != nil {
+		logger.Errorf("Cannot get object metadata %v", err)
+		return err
 	}
 
-	// Garbage collect replication controllers
-	gcRc := Filter(func(el interface{}) bool {
-		return !el.(*Entity).Processed
-	}, Values(kubeRcIndex))
-	for _, rc := range gcRc {
-		rc := rc.(*Entity).Value.(api.ReplicationController)
-		nsLogger.WithFields(log.Fields{"rc": rc.Name}).Info("Deleting rc")
+	if entity != nil {
+		logger.Info("Updating object")
 
-		rc.Spec.Replicas = 0
-		p.Kube.ReplicationControllers(rc.Namespace).Update(&rc)
+		// Copy server populated metadata, so only template changes are compared
+		liveMeta, err := api.ObjectMetaFor(entity.Value.(runtime.Object))
 		if err != nil {
-			nsLogger.WithFields(log.Fields{"rc": rc.Name}).Errorf(
-				"Cannot delete rc, cannot set replicas to 0 %v", err)
-			appErr = err
+			logger.Errorf("Cannot get object metadata %v", err)
+			return err
+		}
+		meta.Namespace = liveMeta.Namespace
+		meta.UID = liveMeta.UID
+		meta.SelfLink = liveMeta.SelfLink
+		meta.CreationTimestamp = liveMeta.CreationTimestamp
+		meta.ResourceVersion = liveMeta.ResourceVersion
+		CopyStatus(entity.Value.(runtime.Object), obj)
+		CopyServerFields(entity.Value.(runtime.Object), obj)
+
+		action := Action{
+			Action: ActionUpdate, Kind: kind.Name, Namespace: nsName, Name: meta.Name, App: app.Name,
+			Diff: Diff(entity.Value, obj),
+		}
+		plan.Add(action)
+		if !plan.DryRun {
+			if err := kind.Update(p.Kube, nsName, obj); err != nil {
+				logger.Errorf("Cannot update object %v", err)
+				return err
+			}
+			p.recordEvent(action, liveMeta.UID, nil)
 		}
 
-		err := p.Kube.ReplicationControllers(rc.Namespace).Delete(rc.Name)
-		if err != nil {
-			nsLogger.WithFields(log.Fields{"rc": rc.Name}).Errorf("Cannot delete rc %v", err)
-			appErr = err
+		entity.Processed = true
+	} else {
+		logger.Info("Creating object")
+		action := Action{Action: ActionCreate, Kind: kind.Name, Namespace: nsName, Name: meta.Name, App: app.Name}
+		plan.Add(action)
+		if !plan.DryRun {
+			if err := kind.Create(p.Kube, nsName, obj); err != nil {
+				logger.Errorf("Cannot create object %v", err)
+				return err
+			}
+			p.recordEvent(action, meta.UID, nil)
 		}
 	}
 
-	return appErr
+	return nil
 }
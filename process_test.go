@@ -1,10 +1,17 @@
 package main
 
 import (
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
 	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path"
 	"testing"
+	"time"
 )
 
 func TestProcessCreateResource(t *testing.T) {
@@ -18,9 +25,290 @@ func TestProcessCreateResource(t *testing.T) {
 	config := &Config{}
 	config.Project = "test"
 
-	p := NewProcess(client, config)
+	p, _ := NewProcess(client, config, NewFileConfigStore("test.yaml"), NewFileRevisionStore("test.yaml.revisions"))
 
 	f, _ := os.Open("test.yaml")
 	config.Load(f)
-	p.CreateNamespaces()
+	p.CreateNamespaces(log.New(), NewPlan(false), NewDeployStatus(config.Namespaces))
+}
+
+// Creates kubernetes client for fake api server, that returns empty lists
+// for all resources
+func newFakeKube(t *testing.T) (*client.Client, *httptest.Server) {
+	kinds := map[string]string{
+		"namespaces":             "NamespaceList",
+		"secrets":                "SecretList",
+		"resourceQuotas":         "ResourceQuotaList",
+		"limitRanges":            "LimitRangeList",
+		"persistentVolumeClaims": "PersistentVolumeClaimList",
+		"endpoints":              "EndpointsList",
+		"services":               "ServiceList",
+		"replicationControllers": "ReplicationControllerList",
+		"pods":                   "PodList",
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		resource := path.Base(req.URL.Path)
+		kind, ok := kinds[resource]
+		if !ok || req.Method != "GET" {
+			t.Errorf("unexpected request %v %v", req.Method, req.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintf(w, `{"kind": "%v", "apiVersion": "v1beta1", "items": []}`, kind)
+	}))
+
+	kube, err := client.New(&client.Config{Host: server.URL, Version: "v1beta1"})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	return kube, server
+}
+
+func TestProcessPlanTemplates(t *testing.T) {
+	kube, server := newFakeKube(t)
+	defer server.Close()
+
+	p, err := NewProcess(kube, &Config{}, NewFileConfigStore("test.yaml"), NewFileRevisionStore("test.yaml.revisions"))
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	p.Config.Templates = append(p.Config.Templates, Template{
+		Name: "secret",
+		Content: `{"kind": "Secret", "apiVersion": "v1beta3", "metadata": {"name": "{{.image}}"},
+			"data": {"key": "dmFsdWU="}}`,
+	})
+	p.Config.Applications[0].Templates = []string{"secret"}
+
+	plan, logger, err := p.Plan()
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	for _, entry := range logger.Entries {
+		if entry.Level == log.ErrorLevel {
+			t.Errorf("expected no errors, got %v", entry.Message)
+		}
+	}
+
+	expected := []string{"Namespace/test-ns1", "Secret/helloworld", "Service/guard", "ReplicationController/node-controller-kekec1"}
+	if len(plan.Actions) != len(expected) {
+		t.Fatalf("expected %v actions, got %v", len(expected), plan.Actions)
+	}
+
+	for i, action := range plan.Actions {
+		if action.Action != ActionCreate || action.Kind+"/"+action.Name != expected[i] {
+			t.Errorf("expected create %v, got %v %v/%v", expected[i], action.Action, action.Kind, action.Name)
+		}
+	}
+}
+
+func TestProcessPlanErrors(t *testing.T) {
+	kube, server := newFakeKube(t)
+	defer server.Close()
+
+	p, err := NewProcess(kube, &Config{}, NewFileConfigStore("test.yaml"), NewFileRevisionStore("test.yaml.revisions"))
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	p.SetConcurrency(1, 2)
+
+	p.Config.Applications = []Application{
+		{Name: "a", Templates: []string{"missing"}},
+		{Name: "b", Templates: []string{"missing"}},
+		{Name: "c", DependsOn: []string{"a"}},
+		{Name: "d"},
+	}
+	p.Config.ApplicationGroups = []ApplicationGroup{{Name: "all", Applications: []string{"a", "b", "c", "d"}}}
+	p.Config.Namespaces = []Namespace{{Name: "ns1", ApplicationGroup: "all"}}
+
+	_, _, err = p.Plan()
+	expected := map[string]string{
+		"a": "Template not found",
+		"b": "Template not found",
+		"c": "Dependency a failed",
+	}
+
+	failed := AppErrors(err)
+	if len(failed) != len(expected) {
+		t.Fatalf("expected %v failed apps, got %v", len(expected), err)
+	}
+
+	for _, appErr := range failed {
+		if appErr.Namespace != "ns1" || expected[appErr.App] != appErr.Message {
+			t.Errorf("unexpected app error %v", appErr)
+		}
+	}
+}
+
+func TestProcessNamespaceStatus(t *testing.T) {
+	kube, server := newFakeKube(t)
+	defer server.Close()
+
+	p, err := NewProcess(kube, &Config{}, NewFileConfigStore("test.yaml"), NewFileRevisionStore("test.yaml.revisions"))
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	p.ParallelNamespaces = 2
+
+	p.Config.Applications = []Application{
+		{Name: "a", Templates: []string{"missing"}},
+		{Name: "b"},
+	}
+	p.Config.ApplicationGroups = []ApplicationGroup{
+		{Name: "broken", Applications: []string{"a", "b"}},
+		{Name: "ok", Applications: []string{"b"}},
+	}
+	p.Config.Namespaces = []Namespace{
+		{Name: "ns1", ApplicationGroup: "broken"},
+		{Name: "ns2", ApplicationGroup: "ok"},
+		{Name: "ns3", ApplicationGroup: "ok"},
+	}
+
+	status := NewDeployStatus(p.Config.Namespaces)
+	err = p.CreateNamespaces(log.New(), NewPlan(true), status)
+	if len(AppErrors(err)) != 1 {
+		t.Fatalf("expected one failed app, got %v", err)
+	}
+
+	expected := map[string]string{"ns1": DeployFailed, "ns2": DeploySucceeded, "ns3": DeploySucceeded}
+	namespaces := status.Namespaces()
+	if len(namespaces) != len(expected) {
+		t.Fatalf("expected %v namespaces, got %v", len(expected), namespaces)
+	}
+
+	for _, ns := range namespaces {
+		if ns.State != expected[ns.Name] {
+			t.Errorf("expected namespace %v to be %v, got %v", ns.Name, expected[ns.Name], ns.State)
+		}
+		if ns.Started.IsZero() || ns.Finished.IsZero() {
+			t.Errorf("expected namespace %v to have start and finish time", ns.Name)
+		}
+	}
+
+	apps := map[string]string{}
+	for _, app := range namespaces[0].Apps {
+		apps[app.Name] = app.State
+	}
+	if apps["a"] != DeployFailed || apps["b"] != DeploySucceeded {
+		t.Errorf("unexpected app results %v", namespaces[0].Apps)
+	}
+}
+
+func TestInheritedObject(t *testing.T) {
+	labels := map[string]string{"kubehub/enable": "true", "kubehub/project": "test", "kubehub/name": "web"}
+	rendered := map[string]string{"kubehub/rendered": "true"}
+
+	cases := []struct {
+		kind      string
+		meta      api.ObjectMeta
+		inherited bool
+	}{
+		{"Endpoints", api.ObjectMeta{Name: "web", Labels: labels}, true},
+		{"Pod", api.ObjectMeta{Name: "web-v1-abcde", Labels: labels}, true},
+		{"Endpoints", api.ObjectMeta{Name: "external", Labels: labels, Annotations: rendered}, false},
+		{"Service", api.ObjectMeta{Name: "web", Labels: labels}, false},
+	}
+
+	for _, c := range cases {
+		if inherited := InheritedObject(c.kind, &c.meta); inherited != c.inherited {
+			t.Errorf("expected %v %v inherited %v, got %v", c.kind, c.meta.Name, c.inherited, inherited)
+		}
+	}
+}
+
+func TestProcessKeepsUnmanagedEndpoints(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+
+	// Endpoints of service web copy its labels, endpoints rendered by removed
+	// app are marked as rendered. Endpoints of v1beta1 api lose labels, so
+	// labels are checked by TestInheritedObject.
+	labels := map[string]string{"kubehub/enable": "true", "kubehub/project": "test", "kubehub/name": "web"}
+	cluster.add("endpoints", "test-prod", &api.Endpoints{ObjectMeta: api.ObjectMeta{Name: "web", Labels: labels}})
+	cluster.add("endpoints", "test-prod", &api.Endpoints{ObjectMeta: api.ObjectMeta{
+		Name:        "external",
+		Labels:      map[string]string{"kubehub/enable": "true", "kubehub/project": "test", "kubehub/name": "external"},
+		Annotations: map[string]string{"kubehub/rendered": "true"},
+	}})
+
+	p := newClusterProcess(t, kube, webConfig("v1", nil))
+	plan := NewPlan(true)
+	if err := p.CreateNamespaces(quietLogger(), plan, NewDeployStatus(p.Config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	for _, action := range plan.Actions {
+		if action.Kind == "Endpoints" && action.Name != "external" {
+			t.Errorf("expected only endpoints of removed app to be planned, got %v", action)
+		}
+	}
+
+	if err := p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if cluster.get("endpoints", "test-prod", "web") == nil {
+		t.Errorf("expected endpoints not rendered by kubehub to be kept, got writes %v", cluster.writeLog())
+	}
+	if cluster.get("endpoints", "test-prod", "external") != nil {
+		t.Errorf("expected endpoints rendered by kubehub to be garbage collected")
+	}
+}
+
+// Run with -race, status of deployment is read while it is written
+func TestProcessStatusWhileDeploying(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+	p := newClusterProcess(t, kube, webConfig("v1", nil))
+
+	p.Reconcile()
+	for timeout := time.After(5 * time.Second); ; {
+		state, logger, _ := p.Status()
+		if logger != nil {
+			for _, entry := range logger.Entries {
+				_ = entry.Message
+			}
+		}
+		for _, ns := range p.NamespaceStatus() {
+			_ = ns.State
+		}
+
+		if state == StateReady && p.Queue().Running == nil {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("expected deployment to finish, got %+v", p.Queue())
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	state, logger, err := p.Status()
+	namespaces := p.NamespaceStatus()
+	if state != StateReady || err != nil || logger == nil || len(namespaces) != 1 || namespaces[0].State != DeploySucceeded {
+		t.Errorf("expected deployment to succeed, got %v %v %v", state, err, namespaces)
+	}
+}
+
+func TestBufferLogger(t *testing.T) {
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	buffer := NewBufferLoggerHook()
+	logger.Hooks.Add(buffer)
+
+	nsLogger := logger.WithFields(log.Fields{"namespace": "test-dev"})
+	nsLogger.Info("Creating namespace")
+	nsLogger.Warn("Namespace exists")
+
+	if len(buffer.Entries) != 2 || buffer.Entries[0].Message != "Creating namespace" || buffer.Entries[1].Level != log.WarnLevel {
+		t.Errorf("expected both entries, got %v", buffer.Entries)
+	}
 }
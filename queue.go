@@ -0,0 +1,167 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// Request to deploy config
+type DeployRequest struct {
+	// Who requested deployment
+	Author string `json:"author,omitempty" yaml:"author,omitempty" description:"Who requested deployment"`
+
+	// What requested deployment
+	Source string `json:"source" yaml:"source" description:"What requested deployment: api, newtag, rollback or reconcile"`
+
+	// Revision that was rolled back to
+	Rollback int `json:"rollback,omitempty" yaml:"rollback,omitempty" description:"Revision that was rolled back to"`
+
+	// Time request was queued
+	Queued time.Time `json:"queued" yaml:"queued" description:"Time request was queued"`
+}
+
+// Running and queued deployments
+type DeployQueue struct {
+	// Running deployment
+	Running *Deploy `json:"running" description:"Running deployment"`
+
+	// Deployment waiting for running one
+	Queued *Deploy `json:"queued" description:"Deployment waiting for running one, requests are coalesced into it"`
+}
+
+// Returns last request that commits config, reconciliations do not
+func commitRequest(requests []DeployRequest) (DeployRequest, bool) {
+	for i := len(requests) - 1; i >= 0; i-- {
+		if requests[i].Source != SourceReconcile {
+			return requests[i], true
+		}
+	}
+
+	return DeployRequest{}, false
+}
+
+// Queues request, if deployment is already running request is coalesced
+// into single deployment of latest config that starts once running
+// deployment finishes. Returns deployment of request.
+func (p *Process) enqueue(request DeployRequest) *Deploy {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	request.Queued = time.Now()
+
+	if p.queued != nil {
+		p.queued.Requests = append(p.queued.Requests, request)
+		if p.queued.Id != 0 {
+			if err := p.Deploys.Save(p.queued); err != nil {
+				log.Errorf("Cannot save deploy %v %v", p.queued.Id, err)
+			}
+		}
+
+		log.WithFields(log.Fields{"deploy": p.queued.Id, "requests": len(p.queued.Requests)}).Info("Coalesced into queued deployment")
+		queued := *p.queued
+		return &queued
+	}
+
+	deploy := &Deploy{State: StateQueued, Requests: []DeployRequest{request}}
+	if p.Deploys != nil {
+		if err := p.Deploys.Create(deploy); err != nil {
+			log.Errorf("Cannot record deploy %v", err)
+			deploy.Id = 0
+		}
+	}
+
+	if p.running {
+		p.queued = deploy
+	} else {
+		p.running = true
+		p.start(deploy)
+		go p.run(deploy)
+	}
+
+	queued := *deploy
+	return &queued
+}
+
+// Marks deployment as current and starts streaming its events, process
+// mutex must be locked
+func (p *Process) start(deploy *Deploy) {
+	deploy.State = StateProcessing
+	deploy.Started = time.Now()
+	p.current = deploy
+	p.state = StateProcessing
+	p.stream.Start(*deploy)
+}
+
+// Runs deployments one after another until queue is empty
+func (p *Process) run(deploy *Deploy) {
+	for deploy != nil {
+		p.runDeploy(deploy)
+
+		p.mutex.Lock()
+		deploy, p.queued = p.queued, nil
+		p.running = deploy != nil
+		if deploy != nil {
+			p.start(deploy)
+		}
+		p.mutex.Unlock()
+	}
+}
+
+// Runs deployment on copy of config taken when it starts, config is
+// committed as new revision, so coalesced requests deploy latest config.
+// Reconciliations alone deploy config of last committed revision.
+func (p *Process) runDeploy(deploy *Deploy) {
+	var rev *Revision
+	var err error
+	config := p.deployedConfig()
+	if request, ok := commitRequest(deploy.Requests); ok {
+		if config, err = p.configSnapshot(); err == nil {
+			rev, err = p.commit(config, request, deploy.Id)
+		}
+	}
+
+	if err != nil {
+		log.WithFields(log.Fields{"deploy": deploy.Id}).Errorf("Cannot commit config %v", err)
+		p.mutex.Lock()
+		p.err = err
+		p.mutex.Unlock()
+		p.finishDeploy(err)
+
+		p.mutex.Lock()
+		p.state = StateReady
+		p.mutex.Unlock()
+		return
+	}
+
+	if rev != nil {
+		p.mutex.Lock()
+		deploy.Revision = rev.Id
+		p.mutex.Unlock()
+	}
+
+	if deploy.Id != 0 {
+		if err := p.Deploys.Save(deploy); err != nil {
+			log.Errorf("Cannot save deploy %v %v", deploy.Id, err)
+		}
+	}
+
+	p.deploy(config, rev)
+}
+
+// Returns running and queued deployments
+func (p *Process) Queue() DeployQueue {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	queue := DeployQueue{}
+	if p.running && p.current != nil {
+		running := *p.current
+		queue.Running = &running
+	}
+	if p.queued != nil {
+		queued := *p.queued
+		queue.Queued = &queued
+	}
+
+	return queue
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Config store that blocks saves until they are released
+type blockingStore struct {
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Load(config *Config) error {
+	return ErrConfigNotFound
+}
+
+func (s *blockingStore) Save(config *Config) error {
+	s.saving <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestDeployQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kube, server := newFakeKube(t)
+	defer server.Close()
+
+	store := &blockingStore{saving: make(chan struct{}), release: make(chan struct{})}
+	p, err := NewProcess(kube, &Config{}, store, NewFileRevisionStore(dir+"/revisions"))
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	p.Deploys = NewFileDeployStore(dir+"/deploys", 0)
+
+	first, err := p.Commit("alice", SourceApi)
+	if err != nil || first.Id != 1 || first.State != StateProcessing {
+		t.Fatalf("expected deploy 1 to start, got %v %v", first, err)
+	}
+	<-store.saving
+
+	// Requests made while deploy 1 runs are coalesced into deploy 2
+	second, _ := p.Commit("bob", SourceNewtag)
+	p.Reconcile()
+	third, _ := p.Commit("carol", SourceNewtag)
+	for _, deploy := range []*Deploy{second, third} {
+		if deploy == nil || deploy.Id != 2 || deploy.State != StateQueued {
+			t.Errorf("expected request queued as deploy 2, got %v", deploy)
+		}
+	}
+
+	queue := p.Queue()
+	if queue.Running == nil || queue.Running.Id != 1 || queue.Queued == nil || len(queue.Queued.Requests) != 3 {
+		t.Fatalf("expected deploy 1 running and 3 requests queued, got %+v", queue)
+	}
+
+	past, events, err := p.DeployEvents(2)
+	if err != nil || len(past) != 1 || past[0].Deploy.State != StateQueued || events == nil {
+		t.Fatalf("expected to wait for queued deploy, got %v %v", past, err)
+	}
+
+	store.release <- struct{}{}
+	<-store.saving
+	store.release <- struct{}{}
+
+	states := []int{}
+	for event := range events {
+		if event.Type == EventState {
+			states = append(states, event.Deploy.State)
+		}
+	}
+	if len(states) != 2 || states[0] != StateProcessing || states[1] != StateReady {
+		t.Errorf("expected deploy 2 to start and finish, got states %v", states)
+	}
+
+	for timeout := time.After(5 * time.Second); p.Queue().Running != nil; {
+		select {
+		case <-timeout:
+			t.Fatalf("expected queue to drain, got %+v", p.Queue())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	revisions, err := p.Revisions.List()
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %v %v", revisions, err)
+	}
+	if rev := revisions[1]; rev.Author != "carol" || rev.Source != SourceNewtag || rev.Deploy != 2 {
+		t.Errorf("expected revision of last request deployed by deploy 2, got %v", rev)
+	}
+
+	deploys, err := p.Deploys.List()
+	if err != nil || len(deploys) != 2 || deploys[1].Revision != 2 || deploys[1].State != StateReady {
+		t.Errorf("expected deploy 2 of revision 2 to be ready, got %v %v", deploys, err)
+	}
+}
+
+func TestCommitRequest(t *testing.T) {
+	if _, ok := commitRequest([]DeployRequest{{Source: SourceReconcile}}); ok {
+		t.Errorf("expected reconciliation not to commit config")
+	}
+
+	request, ok := commitRequest([]DeployRequest{
+		{Source: SourceApi, Author: "alice"},
+		{Source: SourceRollback, Author: "bob", Rollback: 3},
+		{Source: SourceReconcile},
+	})
+	if !ok || request.Author != "bob" || request.Rollback != 3 {
+		t.Errorf("expected rollback by bob, got %v %v", request, ok)
+	}
+}
+
+func TestDeployConfigSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	kube, server := newFakeKube(t)
+	defer server.Close()
+
+	store := &blockingStore{saving: make(chan struct{}), release: make(chan struct{})}
+	p, err := NewProcess(kube, &Config{Project: "test"}, store, NewFileRevisionStore(dir+"/revisions"))
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	a, _ := NewApi(p)
+
+	if _, err := p.Commit("alice", SourceApi); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	<-store.saving
+
+	// Config written through api while deployment runs is not deployed by it
+	a.lock.Lock()
+	p.Config.Project = "changed"
+	a.lock.Unlock()
+
+	store.release <- struct{}{}
+	for timeout := time.After(5 * time.Second); p.Queue().Running != nil; {
+		select {
+		case <-timeout:
+			t.Fatalf("expected queue to drain, got %+v", p.Queue())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	revisions, err := p.Revisions.List()
+	if err != nil || len(revisions) != 1 || revisions[0].Config.Project != "test" {
+		t.Errorf("expected revision of config snapshot, got %v %v", revisions, err)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SourceApi       = "api"
+	SourceNewtag    = "newtag"
+	SourceRollback  = "rollback"
+	SourceReconcile = "reconcile"
+)
+
+var ErrRevisionNotFound = errors.New("Revision not found")
+
+// Log entry of deployment
+type LogEntry struct {
+	// Time of entry
+	Time time.Time `json:"time" yaml:"time" description:"Time of entry"`
+
+	// Log level
+	Level string `json:"level" yaml:"level" description:"Log level"`
+
+	// Log message
+	Message string `json:"msg" yaml:"msg" description:"Log message"`
+
+	// Log fields
+	Fields map[string]interface{} `json:"fields" yaml:"fields" description:"Structured log fields"`
+}
+
+// Deployed config revision
+type Revision struct {
+	// Revision number
+	Id int `json:"id" yaml:"id" description:"Revision number"`
+
+	// Time of deployment
+	Created time.Time `json:"created" yaml:"created" description:"Time of deployment"`
+
+	// Who deployed revision
+	Author string `json:"author" yaml:"author" description:"Who deployed revision"`
+
+	// What triggered deployment
+	Source string `json:"source" yaml:"source" description:"What triggered deployment: api, newtag or rollback"`
+
+	// Revision that was rolled back to
+	Rollback int `json:"rollback,omitempty" yaml:"rollback,omitempty" description:"Revision that was rolled back to"`
+
+	// Deploy of revision
+	Deploy int `json:"deploy,omitempty" yaml:"deploy,omitempty" description:"Number of deploy of revision, its logs can be queried"`
+
+	// Snapshot of deployed config
+	Config Config `json:"config" yaml:"config" description:"Snapshot of deployed config"`
+
+	// Deployment state
+	State int `json:"state" yaml:"state" description:"Deployment state"`
+
+	// Deployment error
+	Error string `json:"err,omitempty" yaml:"err,omitempty" description:"Deployment error"`
+
+	// Errors of apps that failed to deploy
+	Failed []*AppError `json:"failed,omitempty" yaml:"failed,omitempty" description:"Errors of apps that failed to deploy"`
+
+	// Deployment logs
+	Logs []LogEntry `json:"logs" yaml:"logs" description:"Deployment logs"`
+}
+
+// Sets revision deployment result
+func (r *Revision) SetResult(state int, logger *BufferLogger, err error) {
+	r.State = state
+	if err != nil {
+		r.Error = err.Error()
+		r.Failed = AppErrors(err)
+	}
+
+	r.Logs = []LogEntry{}
+	if logger != nil {
+		for _, entry := range logger.Entries {
+			r.Logs = append(r.Logs, NewLogEntry(entry))
+		}
+	}
+}
+
+// Converts logrus entry to log entry
+func NewLogEntry(entry *log.Entry) LogEntry {
+	fields := map[string]interface{}{}
+	for key, value := range entry.Data {
+		fields[key] = value
+	}
+
+	return LogEntry{Time: entry.Time, Level: entry.Level.String(), Message: entry.Message, Fields: fields}
+}
+
+// Storage of deployed revisions
+type RevisionStore interface {
+	// Lists all revisions ordered by id
+	List() ([]*Revision, error)
+
+	// Gets revision by id
+	Get(id int) (*Revision, error)
+
+	// Returns id of last revision, zero if there are none
+	LastId() (int, error)
+
+	// Creates or updates revision
+	Save(rev *Revision) error
+}
+
+// Stores revisions as YAML files in a directory
+type FileRevisionStore struct {
+	Dir string
+}
+
+func NewFileRevisionStore(dir string) *FileRevisionStore {
+	return &FileRevisionStore{Dir: dir}
+}
+
+func (s *FileRevisionStore) path(id int) string {
+	return filepath.Join(s.Dir, strconv.Itoa(id)+".yaml")
+}
+
+// Returns ids of stored revisions in order, read from file names
+func (s *FileRevisionStore) ids() ([]int, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ids := []int{}
+	for _, file := range files {
+		id, err := strconv.Atoi(strings.TrimSuffix(file.Name(), ".yaml"))
+		if err != nil || file.IsDir() {
+			log.Debugf("Skipping revision file %v", file.Name())
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	return ids, nil
+}
+
+func (s *FileRevisionStore) List() ([]*Revision, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*Revision, 0, len(ids))
+	for _, id := range ids {
+		rev, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, nil
+}
+
+func (s *FileRevisionStore) LastId() (int, error) {
+	ids, err := s.ids()
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	return ids[len(ids)-1], nil
+}
+
+func (s *FileRevisionStore) Get(id int) (*Revision, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, ErrRevisionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rev := &Revision{}
+	if err := yaml.Unmarshal(data, rev); err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+func (s *FileRevisionStore) Save(rev *Revision) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(rev)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.path(rev.Id), data, 0644)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileRevisionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubehub")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewFileRevisionStore(dir + "/revisions")
+
+	revisions, err := store.List()
+	if err != nil || len(revisions) != 0 {
+		t.Errorf("expected no revisions, got %v %v", revisions, err)
+	}
+
+	if id, err := store.LastId(); err != nil || id != 0 {
+		t.Errorf("expected no last id, got %v %v", id, err)
+	}
+
+	f, _ := os.Open("test.yaml")
+	config := Config{}
+	config.Load(f)
+
+	for _, id := range []int{2, 10, 1} {
+		if err := store.Save(&Revision{Id: id, Source: SourceApi, Config: config}); err != nil {
+			t.Errorf("expected success, got %v", err)
+		}
+	}
+
+	revisions, err = store.List()
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if len(revisions) != 3 || revisions[0].Id != 1 || revisions[2].Id != 10 {
+		t.Errorf("expected revisions 1, 2, 10, got %v", revisions)
+	}
+
+	rev, err := store.Get(10)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if rev.Config.Applications[0].Name != "guard" {
+		t.Errorf("expected app 'guard', got %v", rev.Config.Applications)
+	}
+
+	if _, err := store.Get(3); err != ErrRevisionNotFound {
+		t.Errorf("expected revision not found, got %v", err)
+	}
+
+	// Last id is read from file names without decoding revisions
+	ioutil.WriteFile(dir+"/revisions/11.yaml", []byte("{"), 0644)
+	if id, err := store.LastId(); err != nil || id != 11 {
+		t.Errorf("expected last id 11, got %v %v", id, err)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	kerrors "github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/wait"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// Duration written as string, like 30s or 5m
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	return d.parse(value)
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+
+	return d.parse(value)
+}
+
+func (d *Duration) parse(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// Settings of rolling update of replication controller, unset fields are
+// inherited
+type RolloutStrategy struct {
+	// Type of rollout
+	Type string `json:"type,omitempty" yaml:"type,omitempty" description:"Type of rollout: rolling, blueGreen or canary"`
+
+	// Time to wait between rollout steps
+	UpdatePeriod Duration `json:"updatePeriod,omitempty" yaml:"updatePeriod,omitempty" description:"Time to wait between rollout steps, like 5s"`
+
+	// Interval of polling replicas
+	PollInterval Duration `json:"pollInterval,omitempty" yaml:"pollInterval,omitempty" description:"Interval of polling replicas, like 1s"`
+
+	// Time to wait for replicas at every rollout step
+	Timeout Duration `json:"timeout,omitempty" yaml:"timeout,omitempty" description:"Time to wait for replicas at every rollout step, like 5m"`
+
+	// Number of pods that can run above desired number of replicas
+	MaxSurge *int `json:"maxSurge,omitempty" yaml:"maxSurge,omitempty" description:"Number of pods that can run above desired number of replicas"`
+
+	// Number of pods that can be missing from desired number of replicas
+	MaxUnavailable *int `json:"maxUnavailable,omitempty" yaml:"maxUnavailable,omitempty" description:"Number of pods that can be missing from desired number of replicas"`
+
+	// Whether to restore old replication controller when rollout fails
+	Rollback *bool `json:"rollbackOnFailure,omitempty" yaml:"rollbackOnFailure,omitempty" description:"Whether to restore old replication controller when rollout fails"`
+
+	// Number of replicas of canary
+	CanaryReplicas *int `json:"canaryReplicas,omitempty" yaml:"canaryReplicas,omitempty" description:"Number of replicas of new version run alongside old version on canary rollout"`
+
+	// How long canary runs before it is promoted
+	CanaryPeriod Duration `json:"canaryPeriod,omitempty" yaml:"canaryPeriod,omitempty" description:"How long canary runs before it is promoted, unless it is promoted or aborted through api earlier, at most 24h"`
+
+	// How long old replication controller is kept after blue-green switch
+	HoldPeriod Duration `json:"holdPeriod,omitempty" yaml:"holdPeriod,omitempty" description:"How long old replication controller is kept after blue-green switch, so services can be switched back through api, at most 24h"`
+}
+
+// Rollout strategy used when application and its template set none, adds
+// one new pod at a time before removing an old one
+var DefaultRollout = RolloutStrategy{
+	Type:           RolloutRolling,
+	UpdatePeriod:   Duration(1 * time.Second),
+	PollInterval:   Duration(1 * time.Second),
+	Timeout:        Duration(5 * time.Minute),
+	MaxSurge:       intPtr(1),
+	MaxUnavailable: intPtr(0),
+	Rollback:       boolPtr(false),
+	CanaryReplicas: intPtr(1),
+	CanaryPeriod:   Duration(30 * time.Minute),
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// Returns copy of strategy with fields set in other overriding it
+func (r RolloutStrategy) Merge(other *RolloutStrategy) RolloutStrategy {
+	if other == nil {
+		return r
+	}
+
+	if other.Type != "" {
+		r.Type = other.Type
+	}
+	if other.UpdatePeriod != 0 {
+		r.UpdatePeriod = other.UpdatePeriod
+	}
+	if other.PollInterval != 0 {
+		r.PollInterval = other.PollInterval
+	}
+	if other.Timeout != 0 {
+		r.Timeout = other.Timeout
+	}
+	if other.MaxSurge != nil {
+		r.MaxSurge = other.MaxSurge
+	}
+	if other.MaxUnavailable != nil {
+		r.MaxUnavailable = other.MaxUnavailable
+	}
+	if other.Rollback != nil {
+		r.Rollback = other.Rollback
+	}
+	if other.CanaryReplicas != nil {
+		r.CanaryReplicas = other.CanaryReplicas
+	}
+	if other.CanaryPeriod != 0 {
+		r.CanaryPeriod = other.CanaryPeriod
+	}
+	if other.HoldPeriod != 0 {
+		r.HoldPeriod = other.HoldPeriod
+	}
+
+	return r
+}
+
+// Checks that strategy values are usable
+func (r *RolloutStrategy) Validate() error {
+	if r == nil {
+		return nil
+	}
+
+	switch r.Type {
+	case "", RolloutRolling, RolloutBlueGreen, RolloutCanary:
+	default:
+		return errors.New("Rollout type must be rolling, blueGreen or canary")
+	}
+
+	if r.UpdatePeriod < 0 || r.PollInterval < 0 || r.Timeout < 0 || r.CanaryPeriod < 0 || r.HoldPeriod < 0 {
+		return errors.New("Rollout durations cannot be negative")
+	}
+
+	if time.Duration(r.CanaryPeriod) > MaxRolloutWait || time.Duration(r.HoldPeriod) > MaxRolloutWait {
+		return fmt.Errorf("Rollout canaryPeriod and holdPeriod cannot exceed %v", MaxRolloutWait)
+	}
+
+	if (r.MaxSurge != nil && *r.MaxSurge < 0) || (r.MaxUnavailable != nil && *r.MaxUnavailable < 0) {
+		return errors.New("Rollout maxSurge and maxUnavailable cannot be negative")
+	}
+
+	if r.MaxSurge != nil && r.MaxUnavailable != nil && *r.MaxSurge == 0 && *r.MaxUnavailable == 0 {
+		return errors.New("Rollout maxSurge and maxUnavailable cannot be both zero")
+	}
+
+	if r.CanaryReplicas != nil && *r.CanaryReplicas < 1 {
+		return errors.New("Rollout canaryReplicas must be at least 1")
+	}
+
+	return nil
+}
+
+// Returns rollout strategy of application, application settings override
+// settings of its replication controller template, which override defaults
+func (p *Process) RolloutStrategy(app Application) RolloutStrategy {
+	strategy := DefaultRollout
+	for _, tpl := range p.Config.Templates {
+		if tpl.Name == app.ReplicationController {
+			strategy = strategy.Merge(tpl.Rollout)
+		}
+	}
+
+	return strategy.Merge(app.Rollout)
+}
+
+// Returns number of replicas of new and old controller after next step of
+// rollout, keeping total number of replicas between desired minus
+// maxUnavailable and desired plus maxSurge
+func rolloutStep(desired, newReplicas, oldReplicas, maxSurge, maxUnavailable int) (int, int) {
+	newTarget := desired + maxSurge - oldReplicas
+	if newTarget > desired {
+		newTarget = desired
+	}
+	if newTarget < newReplicas {
+		newTarget = newReplicas
+	}
+
+	oldTarget := desired - maxUnavailable - newTarget
+	if oldTarget < 0 {
+		oldTarget = 0
+	}
+	if oldTarget > oldReplicas {
+		oldTarget = oldReplicas
+	}
+
+	return newTarget, oldTarget
+}
+
+// Replaces pods of old replication controller with pods of new one
+// according to strategy, new controller is created if it does not exist
+// yet, so interrupted rollouts are continued
+func (p *Process) RollingUpdate(nsName string, oldRc, newRc *api.ReplicationController, strategy RolloutStrategy, logger *log.Entry) error {
+	rcs := p.Kube.ReplicationControllers(nsName)
+	desired := newRc.Spec.Replicas
+
+	current, err := rcs.Get(newRc.Name)
+	if kerrors.IsNotFound(err) {
+		created := *newRc
+		created.Spec.Replicas = 0
+		current, err = rcs.Create(&created)
+	}
+	if err != nil {
+		logger.Errorf("Cannot create replication controller %v", err)
+		return err
+	}
+
+	err = p.rollout(nsName, oldRc.Name, current.Name, desired, current.Spec.Replicas, oldRc.Spec.Replicas, strategy, logger)
+	if err == nil {
+		return rcs.Delete(oldRc.Name)
+	}
+
+	if !*strategy.Rollback {
+		return err
+	}
+
+	logger.WithFields(log.Fields{"to": oldRc.Name}).Warnf("Rolling back %v", err)
+	if rollbackErr := p.resizeController(nsName, oldRc.Name, oldRc.Spec.Replicas, strategy); rollbackErr != nil {
+		logger.Errorf("Cannot roll back %v", rollbackErr)
+		return fmt.Errorf("Rollout failed: %v, rollback failed: %v", err, rollbackErr)
+	}
+	if deleteErr := rcs.Delete(current.Name); deleteErr != nil {
+		logger.Errorf("Cannot delete replication controller %v", deleteErr)
+	}
+
+	return fmt.Errorf("Rollout failed and was rolled back: %v", err)
+}
+
+func (p *Process) rollout(nsName, oldName, newName string, desired, newReplicas, oldReplicas int, strategy RolloutStrategy, logger *log.Entry) error {
+	for newReplicas != desired || oldReplicas != 0 {
+		newTarget, oldTarget := rolloutStep(desired, newReplicas, oldReplicas, *strategy.MaxSurge, *strategy.MaxUnavailable)
+		if newTarget == newReplicas && oldTarget == oldReplicas {
+			return fmt.Errorf("Rollout stuck at %v old and %v new replicas", oldReplicas, newReplicas)
+		}
+
+		logger.WithFields(log.Fields{"old": oldTarget, "new": newTarget}).Debug("Rollout step")
+		if newTarget != newReplicas {
+			if err := p.resizeController(nsName, newName, newTarget, strategy); err != nil {
+				return err
+			}
+			newReplicas = newTarget
+		}
+		if oldTarget != oldReplicas {
+			if err := p.resizeController(nsName, oldName, oldTarget, strategy); err != nil {
+				return err
+			}
+			oldReplicas = oldTarget
+		}
+
+		if newReplicas != desired || oldReplicas != 0 {
+			time.Sleep(time.Duration(strategy.UpdatePeriod))
+		}
+	}
+
+	return nil
+}
+
+// Resizes replication controller and waits until it has desired replicas
+func (p *Process) resizeController(nsName, name string, replicas int, strategy RolloutStrategy) error {
+	rc, err := p.Kube.ReplicationControllers(nsName).Get(name)
+	if err != nil {
+		return err
+	}
+
+	rc.Spec.Replicas = replicas
+	rc, err = p.Kube.ReplicationControllers(nsName).Update(rc)
+	if err != nil {
+		return err
+	}
+
+	return wait.Poll(time.Duration(strategy.PollInterval), time.Duration(strategy.Timeout), client.ControllerHasDesiredReplicas(p.Kube, rc))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRolloutStep(t *testing.T) {
+	cases := []struct {
+		desired, old, surge, unavailable int
+		steps                            [][2]int
+	}{
+		{3, 3, 1, 0, [][2]int{{1, 2}, {2, 1}, {3, 0}}},
+		{3, 3, 0, 1, [][2]int{{0, 2}, {1, 1}, {2, 0}, {3, 0}}},
+		{4, 4, 2, 1, [][2]int{{2, 1}, {4, 0}}},
+		{2, 4, 1, 0, [][2]int{{0, 2}, {1, 1}, {2, 0}}},
+	}
+
+	for _, c := range cases {
+		steps := [][2]int{}
+		newReplicas, oldReplicas := 0, c.old
+		for newReplicas != c.desired || oldReplicas != 0 {
+			newReplicas, oldReplicas = rolloutStep(c.desired, newReplicas, oldReplicas, c.surge, c.unavailable)
+			steps = append(steps, [2]int{newReplicas, oldReplicas})
+			if len(steps) > 10 {
+				break
+			}
+
+			if total := newReplicas + oldReplicas; total > c.desired+c.surge {
+				t.Errorf("expected at most %v replicas, got %v", c.desired+c.surge, total)
+			}
+		}
+
+		if !reflect.DeepEqual(steps, c.steps) {
+			t.Errorf("expected steps %v, got %v", c.steps, steps)
+		}
+	}
+}
+
+func TestRolloutStrategy(t *testing.T) {
+	config := &Config{}
+	err := yaml.Unmarshal([]byte(`
+templates:
+- name: jvm
+  rollout:
+    timeout: 10m
+    maxSurge: 2
+applications:
+- name: api
+  replicationController: jvm
+  rollout:
+    updatePeriod: 30s
+    rollbackOnFailure: true
+`), config)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	p := &Process{Config: config}
+	strategy := p.RolloutStrategy(config.Applications[0])
+	if time.Duration(strategy.Timeout) != 10*time.Minute || time.Duration(strategy.UpdatePeriod) != 30*time.Second {
+		t.Errorf("unexpected durations %v", strategy)
+	}
+	if *strategy.MaxSurge != 2 || *strategy.MaxUnavailable != 0 || !*strategy.Rollback {
+		t.Errorf("unexpected strategy %v", strategy)
+	}
+	if time.Duration(strategy.PollInterval) != time.Second {
+		t.Errorf("expected default poll interval, got %v", time.Duration(strategy.PollInterval))
+	}
+
+	data, err := yaml.Marshal(config.Applications[0].Rollout)
+	if err != nil || string(data) != "updatePeriod: 30s\nrollbackOnFailure: true\n" {
+		t.Errorf("unexpected marshaled strategy %q %v", data, err)
+	}
+
+	invalid := &RolloutStrategy{MaxSurge: intPtr(0), MaxUnavailable: intPtr(0)}
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("expected zero surge and unavailable to be invalid")
+	}
+}
+
+func TestRolloutFailureKeepsOldController(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+	cluster.stuck["web-v2"] = true
+
+	p := newClusterProcess(t, kube, webConfig("v2", &RolloutStrategy{
+		Timeout:      Duration(50 * time.Millisecond),
+		PollInterval: Duration(5 * time.Millisecond),
+		UpdatePeriod: Duration(time.Millisecond),
+		Rollback:     boolPtr(true),
+	}))
+
+	err := p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces))
+	if len(AppErrors(err)) != 1 {
+		t.Fatalf("expected failed rollout, got %v", err)
+	}
+
+	old, ok := cluster.get("replicationControllers", "test-prod", "web-v1").(*api.ReplicationController)
+	if !ok || old.Spec.Replicas != 2 {
+		t.Errorf("expected old controller to be rolled back to 2 replicas, got %v", old)
+	}
+	if cluster.get("replicationControllers", "test-prod", "web-v2") != nil {
+		t.Errorf("expected new controller to be removed")
+	}
+}
+
+func TestRolloutResumesWithSeveralControllers(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	// Interrupted rollout from web-v1 to web-v2 and controller left by
+	// an earlier one
+	cluster.addWeb("v1")
+	cluster.addController("v2", 1)
+	cluster.addController("v0", 1)
+
+	p := newClusterProcess(t, kube, webConfig("v2", &RolloutStrategy{
+		PollInterval: Duration(5 * time.Millisecond),
+		UpdatePeriod: Duration(time.Millisecond),
+	}))
+
+	plan := NewPlan(true)
+	if err := p.CreateNamespaces(quietLogger(), plan, NewDeployStatus(p.Config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	actions := map[string]Action{}
+	for _, action := range plan.Actions {
+		if action.Kind == "ReplicationController" {
+			actions[action.Name] = action
+		}
+	}
+	if len(actions) != 2 || actions["web-v1"].Action != ActionRollingUpdate || actions["web-v1"].To != "web-v2" || actions["web-v0"].Action != ActionDelete {
+		t.Errorf("expected rollout from web-v1 and deletion of web-v0, got %v", plan.Actions)
+	}
+
+	if err := p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if rc, ok := cluster.get("replicationControllers", "test-prod", "web-v2").(*api.ReplicationController); !ok || rc.Spec.Replicas != 2 {
+		t.Errorf("expected web-v2 to be rolled out to 2 replicas, got %v", rc)
+	}
+	for _, name := range []string{"web-v1", "web-v0"} {
+		if cluster.get("replicationControllers", "test-prod", name) != nil {
+			t.Errorf("expected %v to be removed", name)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DeployPending   = "pending"
+	DeployRunning   = "running"
+	DeploySucceeded = "succeeded"
+	DeployFailed    = "failed"
+)
+
+const (
+	HealthReady   = "ready"
+	HealthUnready = "unready"
+)
+
+// Result of app deployment
+type AppResult struct {
+	// Application name
+	Name string `json:"name" description:"Application name"`
+
+	// Deployment state of app
+	State string `json:"state" description:"Deployment state of app: succeeded or failed"`
+
+	// Deployment error
+	Error string `json:"err,omitempty" description:"Deployment error"`
+
+	// Health of app, empty if readiness was not checked
+	Health string `json:"health,omitempty" description:"Health of app: ready or unready, empty if readiness was not checked"`
+
+	// Time app deployment started
+	Started time.Time `json:"started" description:"Time app deployment started"`
+
+	// Time app deployment finished
+	Finished time.Time `json:"finished" description:"Time app deployment finished"`
+}
+
+// Deployment status of namespace
+type NamespaceStatus struct {
+	// Namespace name
+	Name string `json:"name" description:"Namespace name"`
+
+	// Deployment state of namespace
+	State string `json:"state" description:"Deployment state of namespace: pending, running, succeeded or failed"`
+
+	// Namespace error
+	Error string `json:"err,omitempty" description:"Deployment error"`
+
+	// Time namespace deployment started
+	Started time.Time `json:"started,omitempty" description:"Time namespace deployment started"`
+
+	// Time namespace deployment finished
+	Finished time.Time `json:"finished,omitempty" description:"Time namespace deployment finished"`
+
+	// Results of deployed apps
+	Apps []AppResult `json:"apps" description:"Results of deployed apps"`
+}
+
+// Deployment status of all namespaces
+type DeployStatus struct {
+	namespaces []*NamespaceStatus
+	mutex      sync.RWMutex
+}
+
+func NewDeployStatus(namespaces []Namespace) *DeployStatus {
+	status := &DeployStatus{namespaces: []*NamespaceStatus{}}
+	for _, ns := range namespaces {
+		status.namespaces = append(status.namespaces, &NamespaceStatus{Name: ns.Name, State: DeployPending, Apps: []AppResult{}})
+	}
+
+	return status
+}
+
+func (s *DeployStatus) namespace(name string) *NamespaceStatus {
+	for _, ns := range s.namespaces {
+		if ns.Name == name {
+			return ns
+		}
+	}
+
+	ns := &NamespaceStatus{Name: name, State: DeployPending, Apps: []AppResult{}}
+	s.namespaces = append(s.namespaces, ns)
+	return ns
+}
+
+// Marks namespace as running
+func (s *DeployStatus) Start(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ns := s.namespace(name)
+	ns.State = DeployRunning
+	ns.Started = time.Now()
+}
+
+// Marks namespace as finished, failed if err is not nil
+func (s *DeployStatus) Finish(name string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ns := s.namespace(name)
+	ns.State = DeploySucceeded
+	ns.Finished = time.Now()
+	if err != nil {
+		ns.State = DeployFailed
+		ns.Error = err.Error()
+	}
+}
+
+// Records result and health of app deployment in namespace
+func (s *DeployStatus) AddApp(name, app string, started time.Time, health string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := AppResult{Name: app, State: DeploySucceeded, Health: health, Started: started, Finished: time.Now()}
+	if err != nil {
+		result.State = DeployFailed
+		result.Error = err.Error()
+	}
+
+	ns := s.namespace(name)
+	ns.Apps = append(ns.Apps, result)
+}
+
+// Returns copy of status of all namespaces
+func (s *DeployStatus) Namespaces() []NamespaceStatus {
+	if s == nil {
+		return []NamespaceStatus{}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	namespaces := []NamespaceStatus{}
+	for _, ns := range s.namespaces {
+		copied := *ns
+		copied.Apps = append([]AppResult{}, ns.Apps...)
+		namespaces = append(namespaces, copied)
+	}
+
+	return namespaces
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	kerrors "github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/fields"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"gopkg.in/yaml.v2"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrConfigNotFound = errors.New("Config not found")
+	ErrConfigConflict = errors.New("Config was changed by someone else")
+)
+
+// Storage of config
+type ConfigStore interface {
+	// Loads config from storage
+	Load(config *Config) error
+
+	// Saves config to storage, backends that support it fail with
+	// ErrConfigConflict if config changed since it was last loaded or saved,
+	// until config is loaded again
+	Save(config *Config) error
+}
+
+// Stores config in a local YAML file
+type FileConfigStore struct {
+	Path string
+}
+
+func NewFileConfigStore(path string) *FileConfigStore {
+	return &FileConfigStore{Path: path}
+}
+
+func (s *FileConfigStore) Load(config *Config) error {
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return ErrConfigNotFound
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return config.Load(f)
+}
+
+func (s *FileConfigStore) Save(config *Config) error {
+	f, err := os.Create(s.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return config.Commit(f)
+}
+
+// Stores config inside the cluster as a secret in a dedicated namespace
+type SecretConfigStore struct {
+	Kube      *client.Client
+	Namespace string
+	Name      string
+
+	resourceVersion string
+}
+
+func NewSecretConfigStore(kube *client.Client, namespace, name string) *SecretConfigStore {
+	return &SecretConfigStore{Kube: kube, Namespace: namespace, Name: name}
+}
+
+func (s *SecretConfigStore) Load(config *Config) error {
+	secret, err := s.Kube.Secrets(s.Namespace).Get(s.Name)
+	if kerrors.IsNotFound(err) {
+		return ErrConfigNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if err := config.Load(bytes.NewReader(secret.Data["config"])); err != nil {
+		return err
+	}
+
+	s.resourceVersion = secret.ResourceVersion
+	return nil
+}
+
+func (s *SecretConfigStore) Save(config *Config) error {
+	buf := bytes.NewBuffer(nil)
+	if err := config.Commit(buf); err != nil {
+		return err
+	}
+
+	secret := newStoreSecret(s.Namespace, s.Name, "config", buf.Bytes())
+	secret.Annotations = map[string]string{"kubehub/config": "true"}
+
+	var saved *api.Secret
+	var err error
+	if s.resourceVersion == "" {
+		if err := ensureNamespace(s.Kube, s.Namespace); err != nil {
+			return err
+		}
+
+		saved, err = s.Kube.Secrets(s.Namespace).Create(secret)
+		if kerrors.IsAlreadyExists(err) {
+			return ErrConfigConflict
+		}
+	} else {
+		secret.ResourceVersion = s.resourceVersion
+		saved, err = s.Kube.Secrets(s.Namespace).Update(secret)
+		if kerrors.IsConflict(err) {
+			return ErrConfigConflict
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	s.resourceVersion = saved.ResourceVersion
+	return nil
+}
+
+// Stores revisions inside the cluster as secrets in a dedicated namespace
+type SecretRevisionStore struct {
+	Kube      *client.Client
+	Namespace string
+	Name      string
+}
+
+func NewSecretRevisionStore(kube *client.Client, namespace, name string) *SecretRevisionStore {
+	return &SecretRevisionStore{Kube: kube, Namespace: namespace, Name: name}
+}
+
+func (s *SecretRevisionStore) secretName(id int) string {
+	return s.Name + "-revision-" + strconv.Itoa(id)
+}
+
+func (s *SecretRevisionStore) List() ([]*Revision, error) {
+	selector, err := labels.Parse("kubehub/revisions=" + s.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := s.Kube.Secrets(s.Namespace).List(selector, fields.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]*Revision, 0, len(secrets.Items))
+	for _, secret := range secrets.Items {
+		rev := &Revision{}
+		if err := yaml.Unmarshal(secret.Data["revision"], rev); err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, rev)
+	}
+	sort.Sort(revisionsById(revisions))
+
+	return revisions, nil
+}
+
+// Returns highest id among names of revision secrets, without decoding them
+func (s *SecretRevisionStore) LastId() (int, error) {
+	selector, err := labels.Parse("kubehub/revisions=" + s.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	secrets, err := s.Kube.Secrets(s.Namespace).List(selector, fields.Everything())
+	if err != nil {
+		return 0, err
+	}
+
+	last := 0
+	for _, secret := range secrets.Items {
+		id, err := strconv.Atoi(strings.TrimPrefix(secret.Name, s.Name+"-revision-"))
+		if err == nil && id > last {
+			last = id
+		}
+	}
+
+	return last, nil
+}
+
+func (s *SecretRevisionStore) Get(id int) (*Revision, error) {
+	secret, err := s.Kube.Secrets(s.Namespace).Get(s.secretName(id))
+	if kerrors.IsNotFound(err) {
+		return nil, ErrRevisionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rev := &Revision{}
+	if err := yaml.Unmarshal(secret.Data["revision"], rev); err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+func (s *SecretRevisionStore) Save(rev *Revision) error {
+	data, err := yaml.Marshal(rev)
+	if err != nil {
+		return err
+	}
+
+	secret := newStoreSecret(s.Namespace, s.secretName(rev.Id), "revision", data)
+	secret.Labels = map[string]string{"kubehub/revisions": s.Name}
+
+	current, err := s.Kube.Secrets(s.Namespace).Get(secret.Name)
+	if kerrors.IsNotFound(err) {
+		if err := ensureNamespace(s.Kube, s.Namespace); err != nil {
+			return err
+		}
+
+		_, err = s.Kube.Secrets(s.Namespace).Create(secret)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	secret.ResourceVersion = current.ResourceVersion
+	_, err = s.Kube.Secrets(s.Namespace).Update(secret)
+	return err
+}
+
+// Sorts revisions by id
+type revisionsById []*Revision
+
+func (r revisionsById) Len() int           { return len(r) }
+func (r revisionsById) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r revisionsById) Less(i, j int) bool { return r[i].Id < r[j].Id }
+
+func newStoreSecret(namespace, name, key string, data []byte) *api.Secret {
+	return &api.Secret{
+		ObjectMeta: api.ObjectMeta{Namespace: namespace, Name: name},
+		Data:       map[string][]byte{key: data},
+		Type:       api.SecretTypeOpaque,
+	}
+}
+
+// Creates namespace if it does not exist yet
+func ensureNamespace(kube *client.Client, name string) error {
+	_, err := kube.Namespaces().Create(&api.Namespace{ObjectMeta: api.ObjectMeta{Name: name}})
+	if err != nil && !kerrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	return nil
+}
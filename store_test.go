@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSecretConfigStore(t *testing.T) {
+	_, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	store := NewSecretConfigStore(kube, "kubehub", "config")
+	if err := store.Load(&Config{}); err != ErrConfigNotFound {
+		t.Fatalf("expected config not found, got %v", err)
+	}
+
+	if err := store.Save(&Config{Project: "test"}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	other := NewSecretConfigStore(kube, "kubehub", "config")
+	config := &Config{}
+	if err := other.Load(config); err != nil || config.Project != "test" {
+		t.Fatalf("expected project test, got %v %v", config.Project, err)
+	}
+
+	if err := other.Save(&Config{Project: "other"}); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if err := store.Save(&Config{Project: "stale"}); err != ErrConfigConflict {
+		t.Errorf("expected config conflict, got %v", err)
+	}
+
+	// Stale store keeps conflicting instead of replacing changed config
+	if err := store.Save(&Config{Project: "stale"}); err != ErrConfigConflict {
+		t.Errorf("expected second save of stale store to conflict, got %v", err)
+	}
+
+	config = &Config{}
+	if err := store.Load(config); err != nil || config.Project != "other" {
+		t.Fatalf("expected project other, got %v %v", config.Project, err)
+	}
+	if err := store.Save(&Config{Project: "reloaded"}); err != nil {
+		t.Errorf("expected save after reload to succeed, got %v", err)
+	}
+	if err := other.Save(&Config{Project: "other"}); err != ErrConfigConflict {
+		t.Errorf("expected other store to conflict, got %v", err)
+	}
+}
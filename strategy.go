@@ -0,0 +1,377 @@
+package main
+
+import (
+	"errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	kerrors "github.com/GoogleCloudPlatform/kubernetes/pkg/api/errors"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/wait"
+	log "github.com/Sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	RolloutRolling   = "rolling"
+	RolloutBlueGreen = "blueGreen"
+	RolloutCanary    = "canary"
+)
+
+var ErrRolloutNotPending = errors.New("No rollout of app is waiting for promotion")
+
+// Longest time rollout waits for promotion, deployment waits with it
+const MaxRolloutWait = 24 * time.Hour
+
+// Rollout waiting for promotion or abort
+type PendingRollout struct {
+	// Kubernetes namespace of app
+	Namespace string `json:"namespace" description:"Kubernetes namespace of app"`
+
+	// Application name
+	App string `json:"app" description:"Application name"`
+
+	// Type of rollout
+	Type string `json:"type" description:"Type of rollout: blueGreen or canary"`
+
+	// Time rollout started waiting
+	Since time.Time `json:"since" description:"Time rollout started waiting"`
+
+	decision chan bool
+}
+
+// Rollouts waiting for promotion or abort, indexed by namespace and app
+type RolloutGates struct {
+	pending map[string]*PendingRollout
+	mutex   sync.Mutex
+}
+
+func NewRolloutGates() *RolloutGates {
+	return &RolloutGates{pending: map[string]*PendingRollout{}}
+}
+
+// Waits until rollout of app is promoted or aborted, rollout is promoted
+// when period since it started waiting elapses, returns whether rollout
+// was promoted
+func (g *RolloutGates) Wait(nsName, appName, rolloutType string, since time.Time, period time.Duration) bool {
+	key := nsName + "/" + appName
+	rollout := &PendingRollout{Namespace: nsName, App: appName, Type: rolloutType, Since: since, decision: make(chan bool, 1)}
+
+	g.mutex.Lock()
+	g.pending[key] = rollout
+	g.mutex.Unlock()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.pending, key)
+		g.mutex.Unlock()
+	}()
+
+	if period > MaxRolloutWait {
+		period = MaxRolloutWait
+	}
+
+	select {
+	case promote := <-rollout.decision:
+		return promote
+	case <-time.After(period - time.Since(since)):
+		return true
+	}
+}
+
+// Promotes or aborts rollout of app waiting in namespace
+func (g *RolloutGates) Decide(nsName, appName string, promote bool) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	rollout, ok := g.pending[nsName+"/"+appName]
+	if !ok {
+		return ErrRolloutNotPending
+	}
+
+	select {
+	case rollout.decision <- promote:
+	default:
+		// Already decided
+	}
+
+	return nil
+}
+
+// Returns rollouts waiting for promotion
+func (g *RolloutGates) Pending() []PendingRollout {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	pending := []PendingRollout{}
+	for _, rollout := range g.pending {
+		pending = append(pending, *rollout)
+	}
+
+	return pending
+}
+
+// Promotes or aborts rollout of app waiting in namespace of config
+func (p *Process) DecideRollout(nsName, appName string, promote bool) error {
+	return p.rollouts.Decide(p.Config.Project+"-"+nsName, appName, promote)
+}
+
+// Returns rollouts waiting for promotion
+func (p *Process) PendingRollouts() []PendingRollout {
+	return p.rollouts.Pending()
+}
+
+// Replaces old replication controller of app with new one using rollout
+// type of strategy
+func (p *Process) Rollout(nsName, appName string, oldRc, newRc *api.ReplicationController, strategy RolloutStrategy, logger *log.Entry) error {
+	started := time.Now()
+
+	var err error
+	switch strategy.Type {
+	case RolloutBlueGreen:
+		err = p.BlueGreenUpdate(nsName, appName, oldRc, newRc, strategy, logger)
+	case RolloutCanary:
+		err = p.CanaryUpdate(nsName, appName, oldRc, newRc, strategy, logger)
+	default:
+		err = p.RollingUpdate(nsName, oldRc, newRc, strategy, logger)
+	}
+
+	recordRollout(strategy.Type, started, err)
+	return err
+}
+
+// Pins services of app to pods of old replication controller, creates new
+// replication controller with all replicas alongside it and once it is
+// ready switches services to its pods and removes old replication
+// controller. During hold period of strategy services can be switched back
+// by aborting rollout.
+func (p *Process) BlueGreenUpdate(nsName, appName string, oldRc, newRc *api.ReplicationController, strategy RolloutStrategy, logger *log.Entry) error {
+	services, err := p.appServices(nsName, appName)
+	if err != nil {
+		logger.Errorf("Cannot list services %v", err)
+		return err
+	}
+
+	// New pods can match selectors of services, so services must select only
+	// old pods before new ones start
+	if err := p.setSelectors(nsName, services, oldRc.Spec.Selector); err != nil {
+		logger.Errorf("Cannot pin services %v", err)
+		return err
+	}
+
+	current, err := p.startController(nsName, newRc, newRc.Spec.Replicas)
+	if err != nil {
+		logger.Errorf("Cannot create replication controller %v", err)
+		return err
+	}
+
+	logger.WithFields(log.Fields{"to": newRc.Name}).Info("Waiting for new replication controller to become ready")
+	if err := p.waitControllerReady(nsName, current, strategy); err != nil {
+		logger.Errorf("New replication controller did not become ready %v", err)
+		p.removeController(nsName, current.Name, strategy, logger)
+		return errors.New("New replication controller did not become ready: " + err.Error())
+	}
+
+	logger.WithFields(log.Fields{"to": newRc.Name}).Info("Switching services")
+	if err := p.setSelectors(nsName, services, current.Spec.Selector); err != nil {
+		logger.Errorf("Cannot switch services %v", err)
+		p.setSelectors(nsName, services, oldRc.Spec.Selector)
+		p.removeController(nsName, current.Name, strategy, logger)
+		return err
+	}
+
+	if strategy.HoldPeriod > 0 {
+		logger.Info("Holding old replication controller")
+		if !p.waitRollout(nsName, appName, RolloutBlueGreen, current.Name, time.Duration(strategy.HoldPeriod), logger) {
+			logger.WithFields(log.Fields{"to": oldRc.Name}).Warn("Switching services back")
+			if err := p.setSelectors(nsName, services, oldRc.Spec.Selector); err != nil {
+				logger.Errorf("Cannot switch services back %v", err)
+				return err
+			}
+
+			p.removeController(nsName, current.Name, strategy, logger)
+			return errors.New("Rollout aborted, services switched back")
+		}
+	}
+
+	return p.removeController(nsName, oldRc.Name, strategy, logger)
+}
+
+// Runs canary replicas of new replication controller alongside old one
+// until rollout is promoted, then rolling updates remaining replicas
+func (p *Process) CanaryUpdate(nsName, appName string, oldRc, newRc *api.ReplicationController, strategy RolloutStrategy, logger *log.Entry) error {
+	replicas := *strategy.CanaryReplicas
+	if replicas > newRc.Spec.Replicas {
+		replicas = newRc.Spec.Replicas
+	}
+
+	current, err := p.startController(nsName, newRc, replicas)
+	if err != nil {
+		logger.Errorf("Cannot create replication controller %v", err)
+		return err
+	}
+
+	logger.WithFields(log.Fields{"to": newRc.Name, "replicas": replicas}).Info("Waiting for canary to become ready")
+	if err := p.waitControllerReady(nsName, current, strategy); err != nil {
+		logger.Errorf("Canary did not become ready %v", err)
+		p.removeController(nsName, current.Name, strategy, logger)
+		return errors.New("Canary did not become ready: " + err.Error())
+	}
+
+	logger.Info("Waiting for canary promotion")
+	if !p.waitRollout(nsName, appName, RolloutCanary, current.Name, time.Duration(strategy.CanaryPeriod), logger) {
+		logger.Warn("Removing canary")
+		p.removeController(nsName, current.Name, strategy, logger)
+		return errors.New("Rollout aborted, canary removed")
+	}
+
+	return p.RollingUpdate(nsName, oldRc, newRc, strategy, logger)
+}
+
+// Waits for promotion of rollout to replication controller. Start of the
+// wait is recorded on the controller, so rollout resumed after restart
+// waits only for rest of period. Worker slot held by app is released
+// meanwhile, so waiting rollout does not hold up other apps.
+func (p *Process) waitRollout(nsName, appName, rolloutType, rcName string, period time.Duration, logger *log.Entry) bool {
+	since, err := p.rolloutSince(nsName, rcName)
+	if err != nil {
+		logger.Warnf("Cannot record start of rollout wait %v", err)
+	}
+
+	<-p.workers
+	defer func() { p.workers <- struct{}{} }()
+
+	return p.rollouts.Wait(nsName, appName, rolloutType, since, period)
+}
+
+// Returns time rollout to replication controller started waiting, recording
+// current time on controller if it is not recorded yet
+func (p *Process) rolloutSince(nsName, rcName string) (time.Time, error) {
+	rc, err := p.Kube.ReplicationControllers(nsName).Get(rcName)
+	if err != nil {
+		return time.Now(), err
+	}
+
+	if since, err := time.Parse(time.RFC3339, rc.Annotations["kubehub/rollout-since"]); err == nil {
+		return since, nil
+	}
+
+	since := time.Now()
+	if rc.Annotations == nil {
+		rc.Annotations = map[string]string{}
+	}
+	rc.Annotations["kubehub/rollout-since"] = since.Format(time.RFC3339)
+	_, err = p.Kube.ReplicationControllers(nsName).Update(rc)
+	return since, err
+}
+
+// Creates replication controller with replicas, or resizes it if it
+// already exists
+func (p *Process) startController(nsName string, rc *api.ReplicationController, replicas int) (*api.ReplicationController, error) {
+	rcs := p.Kube.ReplicationControllers(nsName)
+
+	current, err := rcs.Get(rc.Name)
+	if kerrors.IsNotFound(err) {
+		created := *rc
+		created.Spec.Replicas = replicas
+		return rcs.Create(&created)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if current.Spec.Replicas < replicas {
+		current.Spec.Replicas = replicas
+		return rcs.Update(current)
+	}
+
+	return current, nil
+}
+
+// Waits until replication controller has all replicas running and ready
+func (p *Process) waitControllerReady(nsName string, rc *api.ReplicationController, strategy RolloutStrategy) error {
+	return wait.Poll(time.Duration(strategy.PollInterval), time.Duration(strategy.Timeout), func() (bool, error) {
+		return p.controllerReady(nsName, rc)
+	})
+}
+
+// Scales replication controller down to zero and deletes it
+func (p *Process) removeController(nsName, name string, strategy RolloutStrategy, logger *log.Entry) error {
+	if err := p.resizeController(nsName, name, 0, strategy); err != nil {
+		logger.WithFields(log.Fields{"rc": name}).Errorf("Cannot resize replication controller %v", err)
+		return err
+	}
+
+	if err := p.Kube.ReplicationControllers(nsName).Delete(name); err != nil {
+		logger.WithFields(log.Fields{"rc": name}).Errorf("Cannot delete replication controller %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// Returns services of app that select pods
+func (p *Process) appServices(nsName, appName string) ([]api.Service, error) {
+	selector, err := labels.Parse("kubehub/enable=true,kubehub/name=" + appName)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := p.Kube.Services(nsName).List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	services := []api.Service{}
+	for _, service := range list.Items {
+		if len(service.Spec.Selector) > 0 {
+			services = append(services, service)
+		}
+	}
+
+	return services, nil
+}
+
+// Sets selector of services to their original selector extended with
+// selector, so they select only pods of one replication controller
+func (p *Process) setSelectors(nsName string, services []api.Service, selector map[string]string) error {
+	for _, service := range services {
+		current, err := p.Kube.Services(nsName).Get(service.Name)
+		if err != nil {
+			return err
+		}
+
+		current.Spec.Selector = map[string]string{}
+		for key, value := range service.Spec.Selector {
+			current.Spec.Selector[key] = value
+		}
+		for key, value := range selector {
+			current.Spec.Selector[key] = value
+		}
+
+		if _, err := p.Kube.Services(nsName).Update(current); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Whether selector of live service is its template selector extended with
+// selector of replication controller, as set by blue-green rollout
+func SwitchedSelector(live, template, rcSelector map[string]string) bool {
+	for key, value := range template {
+		if liveValue, ok := live[key]; !ok || liveValue != value {
+			return false
+		}
+	}
+
+	for key, value := range live {
+		if _, ok := template[key]; ok {
+			continue
+		}
+		if rcValue, ok := rcSelector[key]; !ok || rcValue != value {
+			return false
+		}
+	}
+
+	return len(live) > len(template)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"testing"
+	"time"
+)
+
+func TestRolloutGates(t *testing.T) {
+	gates := NewRolloutGates()
+	if err := gates.Decide("ns", "api", true); err != ErrRolloutNotPending {
+		t.Errorf("expected no pending rollout, got %v", err)
+	}
+
+	// Rollout is promoted when period elapses
+	if !gates.Wait("ns", "api", RolloutBlueGreen, time.Now(), 10*time.Millisecond) {
+		t.Errorf("expected rollout to be promoted after period")
+	}
+
+	// Rollout resumed after restart waits only for rest of period
+	if !gates.Wait("ns", "api", RolloutCanary, time.Now().Add(-time.Hour), time.Hour) {
+		t.Errorf("expected resumed rollout to be promoted at once")
+	}
+
+	for _, promote := range []bool{true, false} {
+		result := make(chan bool)
+		go func() {
+			result <- gates.Wait("ns", "api", RolloutCanary, time.Now(), time.Hour)
+		}()
+
+		for len(gates.Pending()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if pending := gates.Pending()[0]; pending.App != "api" || pending.Type != RolloutCanary {
+			t.Errorf("unexpected pending rollout %v", pending)
+		}
+
+		if err := gates.Decide("ns", "api", promote); err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+		if promoted := <-result; promoted != promote {
+			t.Errorf("expected promoted %v, got %v", promote, promoted)
+		}
+	}
+
+	if len(gates.Pending()) != 0 {
+		t.Errorf("expected no pending rollouts, got %v", gates.Pending())
+	}
+}
+
+func TestRolloutStrategyType(t *testing.T) {
+	strategy := DefaultRollout.Merge(&RolloutStrategy{Type: RolloutCanary, CanaryPeriod: Duration(time.Minute)})
+	if strategy.Type != RolloutCanary || *strategy.CanaryReplicas != 1 || time.Duration(strategy.CanaryPeriod) != time.Minute {
+		t.Errorf("unexpected strategy %v", strategy)
+	}
+
+	for _, invalid := range []*RolloutStrategy{
+		{Type: "recreate"},
+		{Type: RolloutCanary, CanaryReplicas: intPtr(0)},
+		{Type: RolloutCanary, CanaryPeriod: Duration(MaxRolloutWait + time.Minute)},
+		{Type: RolloutBlueGreen, HoldPeriod: Duration(MaxRolloutWait + time.Minute)},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected strategy %v to be invalid", invalid)
+		}
+	}
+}
+
+func TestRolloutAbortKeepsOldController(t *testing.T) {
+	for _, rollout := range []*RolloutStrategy{
+		{Type: RolloutBlueGreen, HoldPeriod: Duration(time.Hour)},
+		{Type: RolloutCanary},
+	} {
+		cluster, kube, server := newFakeCluster(t)
+		defer server.Close()
+
+		cluster.addWeb("v1")
+		rollout.PollInterval = Duration(5 * time.Millisecond)
+		rollout.Timeout = Duration(time.Second)
+		p := newClusterProcess(t, kube, webConfig("v2", rollout))
+
+		result := make(chan error)
+		go func() {
+			result <- p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces))
+		}()
+
+		for len(p.PendingRollouts()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if len(p.workers) != 0 {
+			t.Errorf("expected waiting %v rollout to release its worker", rollout.Type)
+		}
+		if err := p.DecideRollout("prod", "web", false); err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+		if err := <-result; len(AppErrors(err)) != 1 {
+			t.Fatalf("expected aborted %v rollout, got %v", rollout.Type, err)
+		}
+
+		old, ok := cluster.get("replicationControllers", "test-prod", "web-v1").(*api.ReplicationController)
+		if !ok || old.Spec.Replicas != 2 {
+			t.Errorf("expected old controller to survive %v abort, got %v", rollout.Type, old)
+		}
+		if cluster.get("replicationControllers", "test-prod", "web-v2") != nil {
+			t.Errorf("expected new controller to be removed on %v abort", rollout.Type)
+		}
+
+		service, ok := cluster.get("services", "test-prod", "web").(*api.Service)
+		if !ok || service.Spec.Selector["version"] == "v2" {
+			t.Errorf("expected service to select old pods after %v abort, got %v", rollout.Type, service)
+		}
+	}
+}
+
+func TestCanaryResumesWait(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	// Canary that started waiting before restart
+	cluster.addWeb("v1")
+	cluster.addController("v2", 1)
+	canary := cluster.get("replicationControllers", "test-prod", "web-v2").(*api.ReplicationController)
+	canary.Annotations = map[string]string{"kubehub/rollout-since": time.Now().Add(-time.Hour).Format(time.RFC3339)}
+
+	rollout := &RolloutStrategy{
+		Type: RolloutCanary, CanaryPeriod: Duration(time.Hour),
+		PollInterval: Duration(5 * time.Millisecond), UpdatePeriod: Duration(time.Millisecond), Timeout: Duration(time.Second),
+	}
+	p := newClusterProcess(t, kube, webConfig("v2", rollout))
+
+	result := make(chan error)
+	go func() {
+		result <- p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces))
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("expected success, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected canary to be promoted once its period elapsed, got %v", p.PendingRollouts())
+	}
+
+	if rc, ok := cluster.get("replicationControllers", "test-prod", "web-v2").(*api.ReplicationController); !ok || rc.Spec.Replicas != 2 {
+		t.Errorf("expected canary to be rolled out to 2 replicas, got %v", rc)
+	}
+	if cluster.get("replicationControllers", "test-prod", "web-v1") != nil {
+		t.Errorf("expected old controller to be removed")
+	}
+}
+
+func TestBlueGreenUpdate(t *testing.T) {
+	cluster, kube, server := newFakeCluster(t)
+	defer server.Close()
+
+	cluster.addWeb("v1")
+	rollout := &RolloutStrategy{Type: RolloutBlueGreen, PollInterval: Duration(5 * time.Millisecond), Timeout: Duration(time.Second)}
+	p := newClusterProcess(t, kube, webConfig("v2", rollout))
+
+	if err := p.CreateNamespaces(quietLogger(), NewPlan(false), NewDeployStatus(p.Config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	// Services are pinned to old pods before new pods start
+	pinned, started := -1, -1
+	for i, write := range cluster.writeLog() {
+		if write == "PUT services/test-prod/web" && started < 0 {
+			pinned = i
+		}
+		if write == "POST replicationControllers/test-prod/web-v2" {
+			started = i
+		}
+	}
+	if pinned < 0 || started < pinned {
+		t.Errorf("expected services to be pinned before new controller starts, got %v", cluster.writeLog())
+	}
+
+	service := cluster.get("services", "test-prod", "web").(*api.Service)
+	if service.Spec.Selector["version"] != "v2" || cluster.get("replicationControllers", "test-prod", "web-v1") != nil {
+		t.Fatalf("expected services switched to new controller, got %v", service.Spec.Selector)
+	}
+
+	// Switched selector is kept on next deployment and is not a change
+	plan := NewPlan(true)
+	if err := p.CreateNamespaces(quietLogger(), plan, NewDeployStatus(p.Config.Namespaces)); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	for _, action := range plan.Actions {
+		if action.Kind == "Service" && action.Changes() {
+			t.Errorf("expected switched service to be unchanged, got %v", action.Diff)
+		}
+	}
+}
+
+func TestSwitchedSelector(t *testing.T) {
+	template := map[string]string{"app": "web"}
+	rc := map[string]string{"app": "web", "version": "v1"}
+
+	cases := []struct {
+		live     map[string]string
+		switched bool
+	}{
+		{map[string]string{"app": "web", "version": "v1"}, true},
+		{map[string]string{"app": "web", "version": "v2"}, false},
+		{map[string]string{"app": "web"}, false},
+		{map[string]string{"app": "api", "version": "v1"}, false},
+		{map[string]string{"app": "web", "version": "v1", "track": "canary"}, false},
+	}
+
+	for _, c := range cases {
+		if switched := SwitchedSelector(c.live, template, rc); switched != c.switched {
+			t.Errorf("expected selector %v switched %v, got %v", c.live, c.switched, switched)
+		}
+	}
+}
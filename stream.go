@@ -0,0 +1,213 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"sync"
+)
+
+// Types of streamed deployment events
+const (
+	EventLog   = "log"
+	EventState = "state"
+)
+
+// Number of events buffered for subscriber, slower subscribers are dropped
+const subscriberBuffer = 256
+
+// Log entry or state transition of deployment
+type DeployEvent struct {
+	// Type of event
+	Type string `json:"type" description:"Type of event: log or state"`
+
+	// Log entry
+	Entry *LogEntry `json:"entry,omitempty" description:"Log entry, set for log events"`
+
+	// Deployment
+	Deploy *Deploy `json:"deploy,omitempty" description:"Deployment, set for state events"`
+}
+
+// Broadcasts events of current deployment to subscribers, events are kept
+// until next deployment starts, so late subscribers receive them as well
+type DeployStream struct {
+	id          int
+	events      []DeployEvent
+	finished    bool
+	subscribers map[chan DeployEvent]bool
+	next        map[chan DeployEvent]int
+	mutex       sync.Mutex
+}
+
+func NewDeployStream() *DeployStream {
+	return &DeployStream{
+		finished:    true,
+		subscribers: map[chan DeployEvent]bool{},
+		next:        map[chan DeployEvent]int{},
+	}
+}
+
+// Starts streaming events of deployment
+func (s *DeployStream) Start(deploy Deploy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closeSubscribers()
+	for subscriber, id := range s.next {
+		if id == deploy.Id {
+			s.subscribers[subscriber] = true
+		} else {
+			close(subscriber)
+		}
+	}
+	s.next = map[chan DeployEvent]int{}
+
+	s.id = deploy.Id
+	s.events = []DeployEvent{}
+	s.finished = false
+	s.publish(DeployEvent{Type: EventState, Deploy: &deploy})
+}
+
+// Publishes final state of deployment and ends streams of subscribers
+func (s *DeployStream) Finish(deploy Deploy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if deploy.Id != s.id || s.finished {
+		return
+	}
+
+	s.publish(DeployEvent{Type: EventState, Deploy: &deploy})
+	s.finished = true
+	s.closeSubscribers()
+}
+
+// Publishes event of deployment, events of other than current deployment
+// are ignored
+func (s *DeployStream) Publish(id int, event DeployEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if id != s.id || s.finished {
+		return
+	}
+
+	s.publish(event)
+}
+
+func (s *DeployStream) publish(event DeployEvent) {
+	s.events = append(s.events, event)
+
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			// Subscriber cannot keep up, end its stream instead of slowing
+			// down deployment
+			delete(s.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+func (s *DeployStream) closeSubscribers() {
+	for subscriber := range s.subscribers {
+		close(subscriber)
+	}
+	s.subscribers = map[chan DeployEvent]bool{}
+}
+
+// Returns events of deployment published so far and channel of further
+// events, closed when deployment finishes, or false if deployment is not
+// current one. Channel is nil if deployment already finished.
+func (s *DeployStream) Subscribe(id int) ([]DeployEvent, <-chan DeployEvent, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if id != s.id || s.events == nil {
+		return nil, nil, false
+	}
+
+	past := make([]DeployEvent, len(s.events))
+	copy(past, s.events)
+	if s.finished {
+		return past, nil, true
+	}
+
+	subscriber := make(chan DeployEvent, subscriberBuffer)
+	s.subscribers[subscriber] = true
+
+	return past, subscriber, true
+}
+
+// Returns channel of events of deployment that starts next, closed if
+// other deployment starts
+func (s *DeployStream) SubscribeNext(id int) <-chan DeployEvent {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	subscriber := make(chan DeployEvent, subscriberBuffer)
+	s.next[subscriber] = id
+
+	return subscriber
+}
+
+// Stops sending events to subscriber
+func (s *DeployStream) Unsubscribe(subscriber <-chan DeployEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for ch := range s.subscribers {
+		if ch == subscriber {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	for ch := range s.next {
+		if ch == subscriber {
+			delete(s.next, ch)
+			close(ch)
+		}
+	}
+}
+
+// Logrus hook that publishes entries to stream of deployment
+type StreamLogger struct {
+	Stream *DeployStream
+	Id     int
+}
+
+func (l *StreamLogger) Fire(entry *log.Entry) error {
+	logEntry := NewLogEntry(entry)
+	l.Stream.Publish(l.Id, DeployEvent{Type: EventLog, Entry: &logEntry})
+	return nil
+}
+
+func (l *StreamLogger) Levels() []log.Level {
+	return []log.Level{
+		log.PanicLevel,
+		log.FatalLevel,
+		log.ErrorLevel,
+		log.WarnLevel,
+		log.InfoLevel,
+		log.DebugLevel,
+	}
+}
+
+// Returns events of finished deployment from its stored logs
+func StoredEvents(store DeployStore, id int) ([]DeployEvent, error) {
+	deploy, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := store.Logs(id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []DeployEvent{}
+	for i := range entries {
+		events = append(events, DeployEvent{Type: EventLog, Entry: &entries[i]})
+	}
+
+	return append(events, DeployEvent{Type: EventState, Deploy: deploy}), nil
+}
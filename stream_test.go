@@ -0,0 +1,76 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDeployStream(t *testing.T) {
+	stream := NewDeployStream()
+
+	if _, _, ok := stream.Subscribe(0); ok {
+		t.Errorf("expected no deployment to subscribe to")
+	}
+
+	stream.Start(Deploy{Id: 1, State: StateProcessing})
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(&StreamLogger{Stream: stream, Id: 1})
+	logger.WithFields(log.Fields{"namespace": "test-dev"}).Info("Creating namespace")
+
+	past, events, ok := stream.Subscribe(1)
+	if !ok || len(past) != 2 || past[0].Type != EventState || past[1].Entry.Message != "Creating namespace" {
+		t.Fatalf("expected state and log events, got %v %v", past, ok)
+	}
+
+	_, other, _ := stream.Subscribe(1)
+	stream.Unsubscribe(other)
+	stream.Unsubscribe(events)
+	if _, open := <-events; open {
+		t.Errorf("expected unsubscribed stream to be closed")
+	}
+
+	_, events, _ = stream.Subscribe(1)
+	logger.Warn("Rolling back")
+	stream.Publish(2, DeployEvent{Type: EventLog, Entry: &LogEntry{Message: "Other deployment"}})
+	stream.Finish(Deploy{Id: 1, State: StateReady, Error: "failed"})
+
+	received := []DeployEvent{}
+	for event := range events {
+		received = append(received, event)
+	}
+
+	if len(received) != 2 || received[0].Entry.Level != "warning" || received[1].Deploy.Error != "failed" {
+		t.Errorf("expected warning and final state, got %v", received)
+	}
+
+	past, events, ok = stream.Subscribe(1)
+	if !ok || len(past) != 4 || events != nil {
+		t.Errorf("expected all events of finished deployment, got %v %v", past, events)
+	}
+
+	if _, _, ok := stream.Subscribe(2); ok {
+		t.Errorf("expected other deployment not to be streamed")
+	}
+}
+
+func TestDeployStreamSlowSubscriber(t *testing.T) {
+	stream := NewDeployStream()
+	stream.Start(Deploy{Id: 1})
+
+	_, events, _ := stream.Subscribe(1)
+	for i := 0; i <= subscriberBuffer; i++ {
+		stream.Publish(1, DeployEvent{Type: EventLog, Entry: &LogEntry{}})
+	}
+
+	count := 0
+	for _ = range events {
+		count++
+	}
+
+	if count != subscriberBuffer {
+		t.Errorf("expected slow subscriber dropped after %v events, got %v", subscriberBuffer, count)
+	}
+}
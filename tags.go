@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Template tags, values can be strings, numbers, booleans, lists or maps
+type Tags map[string]interface{}
+
+func (t *Tags) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	raw := map[string]interface{}{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*t = normalizeTag(raw).(map[string]interface{})
+	return nil
+}
+
+func (t *Tags) UnmarshalJSON(data []byte) error {
+	raw := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	*t = normalizeTag(raw).(map[string]interface{})
+	return nil
+}
+
+// Converts decoded tag value to map[string]interface{} maps and integers
+// to int64, so values look the same whether they come from YAML or JSON
+func normalizeTag(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		out := map[string]interface{}{}
+		for key, val := range v {
+			out[fmt.Sprint(key)] = normalizeTag(val)
+		}
+		return out
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for key, val := range v {
+			out[key] = normalizeTag(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, val := range v {
+			out[i] = normalizeTag(val)
+		}
+		return out
+	case int:
+		return int64(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+
+	return value
+}
+
+// Deep merges tags into t, maps are merged recursively while lists and
+// scalar values are replaced
+func (t Tags) Merge(tags Tags) {
+	mergeTagMaps(t, tags)
+}
+
+func mergeTagMaps(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcOk := value.(map[string]interface{})
+		dstMap, dstOk := dst[key].(map[string]interface{})
+		if srcOk && dstOk {
+			merged := map[string]interface{}{}
+			mergeTagMaps(merged, dstMap)
+			mergeTagMaps(merged, srcMap)
+			dst[key] = merged
+		} else if srcOk {
+			merged := map[string]interface{}{}
+			mergeTagMaps(merged, srcMap)
+			dst[key] = merged
+		} else {
+			dst[key] = value
+		}
+	}
+}
+
+// Returns string value of tag, or empty string if tag is not set
+func (t Tags) String(name string) string {
+	value, ok := t[name]
+	if !ok || value == nil {
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
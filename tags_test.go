@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"testing"
+)
+
+func TestTagsUnmarshal(t *testing.T) {
+	expected := Tags{
+		"replicas": int64(3),
+		"ratio":    0.5,
+		"ports":    []interface{}{int64(80), int64(443)},
+		"env":      map[string]interface{}{"DEBUG": "true", "LIMITS": map[string]interface{}{"cpu": "100m"}},
+	}
+
+	fromYaml := Tags{}
+	if err := yaml.Unmarshal([]byte("replicas: 3\nratio: 0.5\nports: [80, 443]\nenv: {DEBUG: 'true', LIMITS: {cpu: 100m}}"), &fromYaml); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	fromJson := Tags{}
+	if err := json.Unmarshal([]byte(`{"replicas": 3, "ratio": 0.5, "ports": [80, 443], "env": {"DEBUG": "true", "LIMITS": {"cpu": "100m"}}}`), &fromJson); err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if !reflect.DeepEqual(fromYaml, expected) {
+		t.Errorf("expected %v from YAML, got %v", expected, fromYaml)
+	}
+
+	if !reflect.DeepEqual(fromJson, expected) {
+		t.Errorf("expected %v from JSON, got %v", expected, fromJson)
+	}
+}
+
+func TestTagsMerge(t *testing.T) {
+	tags := Tags{}
+	tags.Merge(Tags{"image": "web", "ports": []interface{}{80}, "env": map[string]interface{}{"A": "ns", "B": "ns"}})
+	tags.Merge(Tags{"ports": []interface{}{8080}, "env": map[string]interface{}{"B": "group"}})
+	tags.Merge(Tags{"env": map[string]interface{}{"C": "app"}})
+
+	expected := Tags{
+		"image": "web",
+		"ports": []interface{}{8080},
+		"env":   map[string]interface{}{"A": "ns", "B": "group", "C": "app"},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+}
+
+func TestEffectiveTags(t *testing.T) {
+	config := &Config{}
+	err := yaml.Unmarshal([]byte(`
+applications:
+- name: web
+  tags: {tag: v2, replicas: 3}
+groups:
+- name: all
+  apps: [web]
+  tags: {tag: v1, env: {A: group}}
+namespaces:
+- name: staging
+  group: all
+  tags: {env: {B: ns}}
+  overrides:
+    web: {tag: v3-rc1, env: {A: override}}
+`), config)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	p := &Process{Config: config}
+	tags, err := p.AppTags("staging", "web")
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	expected := Tags{
+		"tag":      "v3-rc1",
+		"replicas": int64(3),
+		"env":      map[string]interface{}{"A": "override", "B": "ns"},
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+
+	if _, err := p.AppTags("staging", "db"); err != ErrAppNotFound {
+		t.Errorf("expected app not found, got %v", err)
+	}
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// Result of template validation
+type TemplateValidation struct {
+	// Whether template is valid
+	Valid bool `json:"valid" description:"Whether template renders to valid kubernetes objects"`
+
+	// Validation error
+	Error string `json:"err,omitempty" description:"Validation error"`
+
+	// Tag variables referenced by template
+	Variables []string `json:"variables" description:"Tag variables referenced by template"`
+
+	// Referenced tag variables that were not supplied
+	Missing []string `json:"missing" description:"Referenced tag variables that were not supplied, sample values were used instead"`
+
+	// Generated objects
+	Objects []string `json:"objects" description:"Kind and name of generated objects"`
+}
+
+// Returns sorted names of tag variables referenced by template and
+// templates it includes
+func (t *Template) Variables(partials []Template) ([]string, error) {
+	found, err := t.variables(partials)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedKeys(found), nil
+}
+
+// Returns tag variables referenced by template and templates it includes,
+// variables only used as arguments of default are optional
+func (t *Template) variables(partials []Template) (map[string]bool, error) {
+	c, err := t.collectVariables(partials)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.found, nil
+}
+
+// Parses template and templates it includes and collects their variables
+func (t *Template) collectVariables(partials []Template) (*variableCollector, error) {
+	c := &variableCollector{partials: partials, visited: map[string]bool{}, found: map[string]bool{}}
+	if err := c.collectTemplate(t.Name, t.Content); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Walks template parse trees and collects referenced fields
+type variableCollector struct {
+	partials []Template
+	visited  map[string]bool
+
+	// Whether referenced variable is required, by variable name
+	found map[string]bool
+
+	// Depth of range and with bodies, where dot is not the root of tags
+	rebound int
+
+	// Templates defined alongside collected template
+	defined map[string]bool
+
+	// Included templates that are neither defined nor partials
+	unresolved []string
+}
+
+func (c *variableCollector) collectTemplate(name, content string) error {
+	c.visited[name] = true
+
+	tp, err := parseTemplate(name, content, nil)
+	if err != nil {
+		return err
+	}
+
+	defined := c.defined
+	c.defined = map[string]bool{}
+	for _, tpl := range tp.Templates() {
+		c.defined[tpl.Name()] = true
+	}
+
+	for _, tpl := range tp.Templates() {
+		if tpl.Tree != nil {
+			c.collect(tpl.Tree.Root)
+		}
+	}
+	c.defined = defined
+
+	return nil
+}
+
+func (c *variableCollector) collect(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.collect(child)
+		}
+	case *parse.ActionNode:
+		c.collect(n.Pipe)
+	case *parse.IfNode:
+		c.collectBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		c.collectRebound(&n.BranchNode)
+	case *parse.WithNode:
+		c.collectRebound(&n.BranchNode)
+	case *parse.TemplateNode:
+		c.collect(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for i, cmd := range n.Cmds {
+			// Field piped into default is optional
+			if i+1 < len(n.Cmds) && isFuncCall(n.Cmds[i+1], "default") && len(cmd.Args) == 1 {
+				if field, ok := cmd.Args[0].(*parse.FieldNode); ok {
+					c.addField(field, false)
+					continue
+				}
+			}
+			c.collect(cmd)
+		}
+	case *parse.CommandNode:
+		optional := isFuncCall(n, "default")
+		for _, arg := range n.Args {
+			if field, ok := arg.(*parse.FieldNode); ok && optional {
+				c.addField(field, false)
+				continue
+			}
+			c.collect(arg)
+		}
+
+		if isFuncCall(n, "include") && len(n.Args) > 1 {
+			if name, ok := n.Args[1].(*parse.StringNode); ok {
+				c.include(name.Text, c.rebound == 0 || len(n.Args) > 2 && isRoot(n.Args[2]))
+			}
+		}
+	case *parse.ChainNode:
+		c.collect(n.Node)
+	case *parse.FieldNode:
+		c.addField(n, true)
+	case *parse.VariableNode:
+		// Fields of root variable are tags everywhere
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			c.add(n.Ident[1], true)
+		}
+	}
+}
+
+func (c *variableCollector) collectBranch(n *parse.BranchNode) {
+	c.collect(n.Pipe)
+	c.collect(n.List)
+	c.collect(n.ElseList)
+}
+
+// Collects branch whose body rebinds dot to result of pipeline, fields in
+// body are fields of that result, else branch keeps the dot
+func (c *variableCollector) collectRebound(n *parse.BranchNode) {
+	c.collect(n.Pipe)
+	c.rebound++
+	c.collect(n.List)
+	c.rebound--
+	c.collect(n.ElseList)
+}
+
+// Collects variables of included partial if it gets root of tags, records
+// names that resolve neither to defined templates nor to partials
+func (c *variableCollector) include(name string, root bool) {
+	if c.defined[name] {
+		return
+	}
+
+	for _, partial := range c.partials {
+		if partial.Name != name {
+			continue
+		}
+
+		if root && !c.visited[name] {
+			rebound := c.rebound
+			c.rebound = 0
+			c.collectTemplate(partial.Name, partial.Content)
+			c.rebound = rebound
+		}
+		return
+	}
+
+	c.unresolved = append(c.unresolved, name)
+}
+
+func (c *variableCollector) addField(field *parse.FieldNode, required bool) {
+	if c.rebound == 0 {
+		c.add(field.Ident[0], required)
+	}
+}
+
+func (c *variableCollector) add(name string, required bool) {
+	c.found[name] = c.found[name] || required
+}
+
+// Whether node is the root variable
+func isRoot(node parse.Node) bool {
+	variable, ok := node.(*parse.VariableNode)
+	return ok && len(variable.Ident) == 1 && variable.Ident[0] == "$"
+}
+
+// Whether command calls function
+func isFuncCall(cmd *parse.CommandNode, name string) bool {
+	if len(cmd.Args) == 0 {
+		return false
+	}
+
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == name
+}
+
+// Error of tags that are missing or do not match declared parameters
+type TagError struct {
+	Template string
+	Missing  []string
+	Invalid  []string
+}
+
+func (e *TagError) Error() string {
+	problems := []string{}
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing tags "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Invalid) > 0 {
+		problems = append(problems, "invalid tags "+strings.Join(e.Invalid, ", "))
+	}
+
+	return fmt.Sprintf("Template %v: %v", e.Template, strings.Join(problems, "; "))
+}
+
+// Resolves tags for rendering, defaults of declared parameters are applied,
+// optional tags are set empty and all referenced and required tags are checked
+func (t *Template) ResolveTags(tags Tags, partials []Template) (Tags, error) {
+	variables, err := t.variables(partials)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := Tags{}
+	for name, value := range tags {
+		resolved[name] = value
+	}
+
+	needed := map[string]bool{}
+	for name, required := range variables {
+		needed[name] = required
+	}
+
+	tagErr := &TagError{Template: t.Name, Missing: []string{}, Invalid: []string{}}
+	for _, param := range t.Parameters {
+		if _, ok := resolved[param.Name]; !ok && param.Default != nil {
+			resolved[param.Name] = *param.Default
+		}
+
+		if param.Required {
+			needed[param.Name] = true
+		}
+
+		if _, ok := resolved[param.Name]; !ok || param.Regex == "" {
+			continue
+		}
+
+		// Lists and maps never match regular expression
+		value := resolved.String(param.Name)
+		switch resolved[param.Name].(type) {
+		case []interface{}, map[string]interface{}:
+			tagErr.Invalid = append(tagErr.Invalid, fmt.Sprintf("%v (must be a scalar matching %v)", param.Name, param.Regex))
+			continue
+		}
+
+		matched, err := regexp.MatchString("^(?:"+param.Regex+")$", value)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			tagErr.Invalid = append(tagErr.Invalid, fmt.Sprintf("%v=%q (must match %v)", param.Name, value, param.Regex))
+		}
+	}
+
+	for name, required := range needed {
+		if _, ok := resolved[name]; ok {
+			continue
+		}
+
+		if required {
+			tagErr.Missing = append(tagErr.Missing, name)
+		} else {
+			resolved[name] = ""
+		}
+	}
+	sort.Strings(tagErr.Missing)
+
+	if len(tagErr.Missing) > 0 || len(tagErr.Invalid) > 0 {
+		return nil, tagErr
+	}
+
+	return resolved, nil
+}
+
+// Checks that declared parameters are named and their regular expressions
+// compile
+func (t *Template) validateParameters() error {
+	for _, param := range t.Parameters {
+		if param.Name == "" {
+			return errors.New("Template parameter name missing")
+		}
+
+		if _, err := regexp.Compile(param.Regex); err != nil {
+			return fmt.Errorf("Template parameter %v regex invalid: %v", param.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns sample tags for all variables and parameters of template, defaults
+// are used for parameters that have them, otherwise each tag gets its own
+// name as value
+func (t *Template) SampleTags(partials []Template) (Tags, error) {
+	variables, err := t.Variables(partials)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := Tags{}
+	for _, name := range variables {
+		tags[name] = name
+	}
+	for _, param := range t.Parameters {
+		tags[param.Name] = param.Name
+		if param.Default != nil {
+			tags[param.Name] = *param.Default
+		}
+	}
+
+	return tags, nil
+}
+
+// Checks that template and templates it includes parse and that included
+// templates exist, other templates of config can be included. Sample tags
+// cannot stand for lists and maps of structured tags, so rendered YAML is
+// only checked for templates that render with sample tags.
+func (t *Template) Validate(config *Config) error {
+	if err := t.validateParameters(); err != nil {
+		return err
+	}
+
+	if err := t.Rollout.Validate(); err != nil {
+		return err
+	}
+
+	c, err := t.collectVariables(config.Templates)
+	if err != nil {
+		return err
+	}
+	if len(c.unresolved) > 0 {
+		return fmt.Errorf("Included template %v not found", strings.Join(c.unresolved, ", "))
+	}
+
+	tags, err := t.SampleTags(config.Templates)
+	if err != nil {
+		return err
+	}
+
+	tp, err := parseTemplate(t.Name, t.Content, config.Templates)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tp.Execute(buf, tags); err != nil {
+		return nil
+	}
+
+	for _, doc := range documentSeparator.Split(buf.String(), -1) {
+		var out interface{}
+		if err := yaml.Unmarshal([]byte(doc), &out); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Renders template with supplied tags, sample values are used for missing
+// tags without defaults, and decodes generated objects
+func (t *Template) Check(client *client.Client, tags Tags, partials []Template) *TemplateValidation {
+	result := &TemplateValidation{Variables: []string{}, Missing: []string{}, Objects: []string{}}
+
+	variables, err := t.variables(partials)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Variables = sortedKeys(variables)
+
+	samples, err := t.SampleTags(partials)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Tags with defaults and optional tags are not sampled
+	defaults := map[string]bool{}
+	for name, required := range variables {
+		defaults[name] = !required
+	}
+	for _, param := range t.Parameters {
+		defaults[param.Name] = param.Default != nil
+	}
+
+	data := Tags{}
+	for _, name := range sortedKeys(samples) {
+		if value, ok := tags[name]; ok {
+			data[name] = value
+		} else if !defaults[name] {
+			data[name] = samples[name]
+			result.Missing = append(result.Missing, name)
+		}
+	}
+	objs, err := t.Generate(client, data, partials)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	for _, obj := range objs {
+		kind, err := ObjectKind(obj)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		meta, err := api.ObjectMetaFor(obj)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+
+		result.Objects = append(result.Objects, kind+"/"+meta.Name)
+	}
+
+	result.Valid = true
+	return result
+}
+
+// Returns sorted keys of map
+func sortedKeys(tags interface{}) []string {
+	keys := []string{}
+	for _, key := range reflect.ValueOf(tags).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	return keys
+}
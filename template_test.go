@@ -0,0 +1,183 @@
+package main
+
+import (
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestTemplateVariables(t *testing.T) {
+	tpl := Template{Content: `{{.name}} {{if .debug}}{{.level | printf "%v"}}{{end}}{{range .ports}}{{.}}{{end}}`}
+	variables, err := tpl.Variables(nil)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if expected := []string{"debug", "level", "name", "ports"}; !reflect.DeepEqual(variables, expected) {
+		t.Errorf("expected variables %v, got %v", expected, variables)
+	}
+}
+
+func TestTemplateVariablesRebound(t *testing.T) {
+	tpl := Template{Content: `{{range .ports}}{{.port}} {{$.name}}{{include "port" .}}{{include "meta" $}}{{end}}` +
+		`{{with .env}}{{.NAME}}{{else}}{{.fallback}}{{end}}`}
+	partials := []Template{
+		{Name: "port", Content: `{{.protocol}}`},
+		{Name: "meta", Content: `{{.project}}`},
+	}
+
+	variables, err := tpl.Variables(partials)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	if expected := []string{"env", "fallback", "name", "ports", "project"}; !reflect.DeepEqual(variables, expected) {
+		t.Errorf("expected variables %v, got %v", expected, variables)
+	}
+}
+
+func TestTemplateValidate(t *testing.T) {
+	content, _ := ioutil.ReadFile("./test-service.yaml")
+	tpl := Template{Name: "test", Content: string(content)}
+	if err := tpl.Validate(&Config{}); err != nil {
+		t.Errorf("expected valid template, got %v", err)
+	}
+
+	tpl.Content = "kind: Service\nmetadata: {{.name"
+	if err := tpl.Validate(&Config{}); err == nil {
+		t.Errorf("expected template syntax error")
+	}
+
+	tpl.Content = "kind: Service\n  metadata: [{{.name}}"
+	if err := tpl.Validate(&Config{}); err == nil {
+		t.Errorf("expected YAML error")
+	}
+}
+
+func TestTemplateValidateStructuredTags(t *testing.T) {
+	tpl := Template{Name: "test", Content: `kind: ReplicationController
+apiVersion: v1beta3
+metadata:
+  name: {{.name}}
+spec:
+  template:
+    spec:
+      containers:
+      - name: {{.name}}
+        image: {{.env.IMAGE}}
+        ports:
+{{- range .ports}}
+        - containerPort: {{.port}}
+{{- end}}
+        env:
+{{- range $name, $value := .env}}
+        - name: {{$name}}
+          value: {{$value | quote}}
+{{- end}}`}
+	if err := tpl.Validate(&Config{}); err != nil {
+		t.Errorf("expected template ranging over structured tags to be valid, got %v", err)
+	}
+
+	tpl.Content = `{{range .ports}}{{include "port" .}}{{end}}`
+	if err := tpl.Validate(&Config{}); err == nil {
+		t.Errorf("expected missing included template error")
+	}
+	if err := tpl.Validate(&Config{Templates: []Template{{Name: "port", Content: "{{.port}}"}}}); err != nil {
+		t.Errorf("expected included partial to resolve, got %v", err)
+	}
+}
+
+func TestTemplateCheck(t *testing.T) {
+	client, _ := client.New(&client.Config{})
+
+	content, _ := ioutil.ReadFile("./test-service.yaml")
+	tpl := Template{Name: "test", Content: string(content)}
+	result := tpl.Check(client, Tags{}, nil)
+	if !result.Valid {
+		t.Fatalf("expected valid template, got %v", result.Error)
+	}
+
+	if !reflect.DeepEqual(result.Missing, []string{"name"}) {
+		t.Errorf("expected missing name tag, got %v", result.Missing)
+	}
+
+	if !reflect.DeepEqual(result.Objects, []string{"Service/name"}) {
+		t.Errorf("expected Service/name object, got %v", result.Objects)
+	}
+
+	tpl.Content = "kind: Unknown\napiVersion: v1beta3\n"
+	if result := tpl.Check(client, nil, nil); result.Valid || result.Error == "" {
+		t.Errorf("expected decode error, got %+v", result)
+	}
+}
+
+func TestTemplateParameters(t *testing.T) {
+	client, _ := client.New(&client.Config{})
+
+	content, _ := ioutil.ReadFile("./test-service.yaml")
+	port := "80"
+	tpl := Template{Name: "test", Content: string(content) + "  # {{.port}} {{.role}}", Parameters: []Parameter{
+		{Name: "port", Default: &port, Regex: "[0-9]+"},
+		{Name: "env", Required: true},
+	}}
+
+	_, err := tpl.Generate(client, Tags{}, nil)
+	tagErr, ok := err.(*TagError)
+	if !ok {
+		t.Fatalf("expected tag error, got %v", err)
+	}
+
+	if !reflect.DeepEqual(tagErr.Missing, []string{"env", "name", "role"}) {
+		t.Errorf("expected missing env, name and role tags, got %v", tagErr.Missing)
+	}
+
+	_, err = tpl.Generate(client, Tags{"name": "web", "role": "web", "env": "prod", "port": "http"}, nil)
+	if tagErr, ok := err.(*TagError); !ok || len(tagErr.Invalid) != 1 {
+		t.Errorf("expected invalid port tag, got %v", err)
+	}
+
+	if _, err := tpl.Generate(client, Tags{"name": "web", "role": "web", "env": "prod"}, nil); err != nil {
+		t.Errorf("expected default port, got %v", err)
+	}
+
+	tpl.Parameters[0].Regex = "[0-9"
+	if err := tpl.Validate(&Config{}); err == nil {
+		t.Errorf("expected invalid regex error")
+	}
+}
+
+func TestTemplateStructuredTags(t *testing.T) {
+	client, _ := client.New(&client.Config{})
+
+	content := `kind: Service
+apiVersion: v1beta3
+metadata:
+  name: {{.name}}
+spec:
+  ports:
+{{- range .ports}}
+    - port: {{.}}
+{{- end}}
+  selector:
+{{toYaml .selector | indent 4}}`
+	tpl := Template{Name: "test", Content: content}
+	objs, err := tpl.Generate(client, Tags{
+		"name":     "web",
+		"ports":    []interface{}{int64(80), int64(443)},
+		"selector": map[string]interface{}{"role": "web", "tier": "frontend"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+
+	service := objs[0].(*api.Service)
+	if len(service.Spec.Ports) != 2 || service.Spec.Ports[1].Port != 443 {
+		t.Errorf("expected ports 80 and 443, got %v", service.Spec.Ports)
+	}
+
+	if service.Spec.Selector["tier"] != "frontend" {
+		t.Errorf("expected selector from map tag, got %v", service.Spec.Selector)
+	}
+}